@@ -0,0 +1,208 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// stream/address is a bitcoin like address
+package address
+
+import (
+    "crypto/ecdh"
+    "crypto/ed25519"
+    "crypto/sha256"
+    "crypto/rand"
+    "golang.org/x/crypto/ripemd160"
+    b58 "github.com/jbenet/go-base58"
+    "errors"
+)
+
+// KeyType is the kind of key agreement a Key uses.
+type KeyType int
+
+const (
+    // P256 is ECDH over NIST P-256, the original Stream curve.
+    P256 KeyType = iota
+    // X25519 is ECDH over Curve25519.
+    X25519
+)
+
+var ErrKeyMismatch = errors.New("keys are of different types")
+
+// curve returns the crypto/ecdh curve of t.
+func (t KeyType) curve() ecdh.Curve {
+    if t == X25519 {
+        return ecdh.X25519()
+    }
+    return ecdh.P256()
+}
+
+func (t KeyType) String() string {
+    if t == X25519 {
+        return "X25519"
+    }
+    return "P-256"
+}
+
+// Public stores the public key
+// derived from the private key, and the public half of its
+// signing key when known (see Key.Sign)
+type Public struct {
+    key *ecdh.PublicKey
+    sign ed25519.PublicKey
+}
+
+// Type returns the KeyType of p.
+func (p *Public) Type() KeyType {
+    if p.key.Curve() == ecdh.X25519() {
+        return X25519
+    }
+    return P256
+}
+
+// Key contains the private and public key
+// however, only the public key is exported.
+type Key struct {
+    private *ecdh.PrivateKey
+    signer ed25519.PrivateKey
+    Public
+}
+
+// NewKey creates a P-256 public/private keypair.
+func NewKey() (*Key, error) {
+    return NewKeyType(P256)
+}
+
+// NewKeyType creates a public/private keypair of type t.
+func NewKeyType(t KeyType) (*Key, error) {
+    private_key, err := t.curve().GenerateKey(rand.Reader)
+    if err != nil {
+        return nil, err
+    }
+
+    return newKey(private_key), nil
+}
+
+func newKey(private_key *ecdh.PrivateKey) *Key {
+    signer := signingKey(private_key)
+    return &Key{ private_key, signer, Public{ private_key.PublicKey(), signer.Public().(ed25519.PublicKey) }}
+}
+
+// PublicKey returns the public key.
+func (k *Key) PublicKey() *Public {
+    return &k.Public
+}
+
+// Marshal returns a byte slice of the public key. P-256 keys are
+// in the uncompressed form specified in section 4.3.6 of ANSI X9.62,
+// X25519 keys are the 32 bytes of RFC 7748.
+func (k *Key) Marshal() []byte {
+    return k.Public.Marshal()
+} 
+
+// UnMarshal decodes a public key of the same type as k, in any
+// form accepted by UnmarshalPublic.
+func (k *Key) UnMarshal(data []byte) (*Public, error) {
+    return UnmarshalPublic(k.Type(), data)
+}
+
+// secret computes the ECDH shared secret between k and the public key p.
+// For P-256 it is the x coordinate of the shared point.
+func (k *Key) secret(p *Public) ([]byte, error) {
+    if p == nil || p.key == nil {
+        return nil, ErrPublicInvalid
+    }
+    if k.Type() != p.Type() {
+        return nil, ErrKeyMismatch
+    }
+
+    return k.private.ECDH(p.key)
+}
+
+// sharedPoint returns the P-256 ECDH shared point as 0x04 || X || Y, with
+// X and Y 32 bytes each. legacy drops leading zero bytes of X and Y, as
+// addresses were made before LegacyAddress.
+func (k *Key) sharedPoint(p *Public, legacy bool) ([]byte, error) {
+    if p == nil || p.key == nil {
+        return nil, ErrPublicInvalid
+    }
+    if k.Type() != p.Type() {
+        return nil, ErrKeyMismatch
+    }
+
+    x, y := p256Shared(k.private, p.key)
+    if x.Sign() == 0 && y.Sign() == 0 {
+        // the point at infinity, as crypto/ecdh refuses
+        return nil, ErrPublicInvalid
+    }
+
+    if legacy {
+        raw := []byte{0x04} // non-compressed
+        raw = append(raw, x.Bytes()...)
+        raw = append(raw, y.Bytes()...)
+        return raw, nil
+    }
+
+    return p256Bytes(x, y), nil
+}
+
+// Address returns the Stream address shared by k and the owner of p.
+// P-256 keys share a StreamVersion address, X25519 keys an X25519Version one.
+func (k *Key) Address(p *Public) (string, error) {
+    if k.Type() == X25519 {
+        return k.AddressVersion(p, X25519Version)
+    }
+    return k.AddressVersion(p, StreamVersion)
+}
+
+// AddressVersion returns the address shared by k and the owner of p
+// with route prefix version, which must be registered.
+func (k *Key) AddressVersion(p *Public, version byte) (string, error) {
+    return k.address(p, version, false)
+}
+
+// LegacyAddress returns the StreamVersion address k and the owner of p
+// shared before the secret was hashed at a fixed width. For about 1 in
+// 128 P-256 pairs it differs from Address; their streams were registered
+// under this address. X25519 secrets were always fixed width, so for
+// them it is the same as Address.
+func (k *Key) LegacyAddress(p *Public) (string, error) {
+    if k.Type() == X25519 {
+        return k.Address(p)
+    }
+    return k.address(p, StreamVersion, true)
+}
+
+func (k *Key) address(p *Public, version byte, legacy bool) (string, error) {
+    if _, ok := LookupVersion(version); !ok {
+        return "", ErrVersion
+    }
+
+    // this is the secret
+    var raw []byte
+    var err error
+    if k.Type() == X25519 {
+        raw, err = k.secret(p)
+    } else {
+        raw, err = k.sharedPoint(p, legacy)
+    }
+    if err != nil {
+        return "", err
+    }
+
+    digest := sha256.Sum256(raw)
+    
+    // why different hash implemtations?
+    ripe := ripemd160.New()
+    ripe.Write(digest[:])
+    a := Address{ Version: version }
+    copy(a.Hash[:], ripe.Sum(nil))
+    
+    return a.String(), nil
+}
+
+func base58EncodeCheck(a []byte) string {
+    sum := checksum(a)
+    
+    b := append(a, sum[:]...)
+    
+    return b58.Encode(b)
+}
\ No newline at end of file
@@ -0,0 +1,211 @@
+package address
+
+import (
+    "testing"
+    "bytes"
+    "crypto/ecdh"
+    "encoding/hex"
+    "encoding/json"
+    "io/ioutil"
+    "math/big"
+)
+
+func TestAddress(t *testing.T) {
+    
+    alice, err := NewKey()
+    if err != nil {
+        t.Fatal("error creating key", err)
+    }
+    
+    bob, err := NewKey()
+    if err != nil {
+       t.Fatal("error creating key", err) 
+    }
+    
+    if bytes.Compare(bob.Marshal(), alice.Marshal()) == 0 {
+        t.Error("public keys match")
+    }
+
+    address1, err := alice.Address(&bob.Public)
+    if err != nil {
+        t.Fatal("error getting address")
+    }
+    
+    address2, err := bob.Address(&alice.Public)
+    if err != nil {
+        t.Fatal("error getting address")
+    }
+    
+    if address1 != address2 {
+        t.Error("addresses do not match")
+    }
+    
+    t.Logf("address: %v\n", address1)
+}
+func TestAddressX25519(t *testing.T) {
+    alice, err := NewKeyType(X25519)
+    if err != nil {
+        t.Fatal("error creating key", err)
+    }
+
+    bob, _ := NewKeyType(X25519)
+    if bob.Type() != X25519 || len(bob.Marshal()) != 32 {
+        t.Error("expected a 32 byte X25519 key")
+    }
+
+    address1, err := alice.Address(&bob.Public)
+    if err != nil {
+        t.Fatal("error getting address", err)
+    }
+
+    address2, _ := bob.Address(&alice.Public)
+    if address1 != address2 {
+        t.Error("addresses do not match")
+    }
+
+    a, err := Parse(address1)
+    if err != nil || a.Version != X25519Version {
+        t.Error("expected an x25519 address, got", a, err)
+    }
+
+    // the PEM forms keep the key type
+    data, _ := alice.MarshalPEM(nil)
+    loaded, err := ParseKey(data, nil)
+    if err != nil {
+        t.Fatal("error parsing key", err)
+    }
+    data, _ = bob.PublicKey().MarshalPEM()
+    peer, err := ParsePublicPEM(data)
+    if err != nil {
+        t.Fatal("error parsing public key", err)
+    }
+    if address3, _ := loaded.Address(peer); address3 != address1 {
+        t.Error("addresses do not match after a PEM round trip")
+    }
+
+    p256, _ := NewKey()
+    if _, err := alice.Address(&p256.Public); err != ErrKeyMismatch {
+        t.Error("expected ErrKeyMismatch, got", err)
+    }
+}
+
+// vectors are shared with ecdhe.py, which checks them with
+// python3 ecdhe.py address/testdata/vectors.json
+type vector struct {
+    Comment string `json:"comment"`
+    Alice string `json:"alice_private"`
+    Bob string `json:"bob_private"`
+    Address string `json:"address"`
+    Legacy string `json:"legacy_address"`
+}
+
+func vectorKey(t *testing.T, s string) *Key {
+    d, err := hex.DecodeString(s)
+    if err != nil {
+        t.Fatal("error decoding private key", err)
+    }
+
+    private_key, err := ecdh.P256().NewPrivateKey(d)
+    if err != nil {
+        t.Fatal("error creating key", err)
+    }
+
+    return newKey(private_key)
+}
+
+func TestAddressVectors(t *testing.T) {
+    data, err := ioutil.ReadFile("testdata/vectors.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var vectors []vector
+    if err := json.Unmarshal(data, &vectors); err != nil {
+        t.Fatal(err)
+    }
+
+    for _, v := range vectors {
+        alice := vectorKey(t, v.Alice)
+        bob := vectorKey(t, v.Bob)
+
+        for _, pair := range [][2]*Key{{alice, bob}, {bob, alice}} {
+            address, err := pair[0].Address(&pair[1].Public)
+            if err != nil {
+                t.Fatal("error getting address", err)
+            }
+            if address != v.Address {
+                t.Errorf("%s: address is %s, want %s", v.Comment, address, v.Address)
+            }
+
+            legacy, err := pair[0].LegacyAddress(&pair[1].Public)
+            if err != nil {
+                t.Fatal("error getting legacy address", err)
+            }
+            if legacy != v.Legacy {
+                t.Errorf("%s: legacy address is %s, want %s", v.Comment, legacy, v.Legacy)
+            }
+        }
+    }
+}
+
+func TestLegacyAddress(t *testing.T) {
+    for _, kt := range []KeyType{P256, X25519} {
+        alice, err := NewKeyType(kt)
+        if err != nil {
+            t.Fatal("error creating key", err)
+        }
+
+        bob, err := NewKeyType(kt)
+        if err != nil {
+            t.Fatal("error creating key", err)
+        }
+
+        address, err := alice.Address(&bob.Public)
+        if err != nil {
+            t.Fatal("error getting address", err)
+        }
+
+        legacy, err := alice.LegacyAddress(&bob.Public)
+        if err != nil {
+            t.Fatal("error getting legacy address", err)
+        }
+
+        // they differ only when X or Y of the P-256 secret has a leading zero byte
+        fixed := true
+        if kt == P256 {
+            point, _ := alice.sharedPoint(&bob.Public, true)
+            fixed = len(point) == 65
+        }
+        if fixed && legacy != address {
+            t.Errorf("%s: legacy address %s differs from %s", kt, legacy, address)
+        }
+    }
+}
+
+func TestAddressMinusGenerator(t *testing.T) {
+    // the private key n-1 has the public key -G, whose sum with G
+    // is the point at infinity
+    scalar := new(big.Int).Sub(p256.N, big.NewInt(1))
+    private, err := ecdh.P256().NewPrivateKey(scalar.FillBytes(make([]byte, 32)))
+    if err != nil {
+        t.Fatal("error creating key", err)
+    }
+    bob := newKey(private)
+
+    alice, err := NewKey()
+    if err != nil {
+        t.Fatal("error creating key", err)
+    }
+
+    a, err := alice.Address(bob.PublicKey())
+    if err != nil {
+        t.Fatal("error getting address", err)
+    }
+    b, err := bob.Address(alice.PublicKey())
+    if err != nil {
+        t.Fatal("error getting address", err)
+    }
+    if a != b {
+        t.Errorf("addresses differ: %s and %s", a, b)
+    }
+}
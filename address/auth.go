@@ -0,0 +1,56 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const authKeyInfo = "streammail/v1/auth-key"
+
+// AuthKey returns the signing key shared by k and the owner of p.
+// Both parties derive the same key from their ECDH secret. Its public
+// half is registered with a Stream server as the stream's verifier, so
+// the server can check requests are signed by one of the parties without
+// learning the secret.
+func (k *Key) AuthKey(p *Public) (ed25519.PrivateKey, error) {
+	seed, err := k.derive(p, authKeyInfo, ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// signingString is what gets signed for a request:
+//
+//	METHOD "\n" REQUEST-URI "\n" DATE "\n" HEX(SHA256(BODY))
+func signingString(method, uri, date string, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	return []byte(strings.Join([]string{method, uri, date, hex.EncodeToString(digest[:])}, "\n"))
+}
+
+// SignRequest signs a Stream API request. uri is the path and query of
+// the request and date the value of its X-Stream-Date header. The result
+// is sent in the X-Stream-Signature header.
+func SignRequest(key ed25519.PrivateKey, method, uri, date string, body []byte) string {
+	sig := ed25519.Sign(key, signingString(method, uri, date, body))
+	return base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// VerifyRequest reports whether signature was made by SignRequest with the
+// private half of verifier for the same request.
+func VerifyRequest(verifier ed25519.PublicKey, method, uri, date string, body []byte, signature string) bool {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || len(verifier) != ed25519.PublicKeySize {
+		return false
+	}
+
+	return ed25519.Verify(verifier, signingString(method, uri, date, body), sig)
+}
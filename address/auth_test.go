@@ -0,0 +1,49 @@
+package address
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestAuthKey(t *testing.T) {
+	alice, bob := newPair(t)
+	_, eve := newPair(t)
+
+	aliceKey, err := alice.AuthKey(&bob.Public)
+	if err != nil {
+		t.Fatal("error deriving auth key", err)
+	}
+
+	bobKey, _ := bob.AuthKey(&alice.Public)
+	if !bytes.Equal(aliceKey, bobKey) {
+		t.Error("auth keys do not match")
+	}
+
+	// the auth key must not be the message key
+	messageKey, _ := alice.MessageKey(&bob.Public)
+	if bytes.Equal(aliceKey.Seed(), messageKey) {
+		t.Error("auth key equals message key")
+	}
+
+	verifier := aliceKey.Public().(ed25519.PublicKey)
+	body := []byte("message one")
+	sig := SignRequest(bobKey, "POST", "/stream/v1/S/message", "1465000000", body)
+	if !VerifyRequest(verifier, "POST", "/stream/v1/S/message", "1465000000", body, sig) {
+		t.Error("valid signature rejected")
+	}
+
+	if VerifyRequest(verifier, "POST", "/stream/v1/S/message", "1465000001", body, sig) {
+		t.Error("signature accepted for a different date")
+	}
+
+	if VerifyRequest(verifier, "POST", "/stream/v1/S/message", "1465000000", []byte("message two"), sig) {
+		t.Error("signature accepted for a different body")
+	}
+
+	eveKey, _ := eve.AuthKey(&bob.Public)
+	sig = SignRequest(eveKey, "POST", "/stream/v1/S/message", "1465000000", body)
+	if VerifyRequest(verifier, "POST", "/stream/v1/S/message", "1465000000", body, sig) {
+		t.Error("signature by a third party accepted")
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// EnvelopeChunk is the version byte of the envelopes of attachment
+// chunks, sealed by a ChunkSealer:
+//
+//	VERSION[1 byte] || NONCE[24 bytes] || XCHACHA20-POLY1305(CHUNK)
+//
+// The additional data is chunkInfo || ID || INDEX[4 bytes] || FINAL[1 byte],
+// so chunks cannot be moved to another attachment, reordered, or the
+// attachment cut short without Open failing.
+const EnvelopeChunk = 0x03
+
+// chunkInfo separates chunk additional data from any other.
+const chunkInfo = "streammail/v1/chunk"
+
+// A ChunkSealer seals the chunks of one attachment with its own key.
+type ChunkSealer struct {
+	aead cipher.AEAD
+	id   []byte
+}
+
+// NewChunkSealer creates a ChunkSealer for the attachment id with a
+// 32 byte key, which must be random and used for no other attachment.
+func NewChunkSealer(key, id []byte) (*ChunkSealer, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChunkSealer{aead, append([]byte{}, id...)}, nil
+}
+
+// additional returns the additional data of chunk index.
+func (c *ChunkSealer) additional(index uint32, final bool) []byte {
+	ad := append([]byte(chunkInfo), c.id...)
+	ad = binary.BigEndian.AppendUint32(ad, index)
+	if final {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+// Seal encrypts chunk number index, final telling whether it is the last.
+func (c *ChunkSealer) Seal(index uint32, final bool, chunk []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	envelope := append([]byte{EnvelopeChunk}, nonce...)
+	return c.aead.Seal(envelope, nonce, chunk, c.additional(index, final)), nil
+}
+
+// Open authenticates and decrypts chunk number index, sealed by Seal
+// with the same index and final.
+func (c *ChunkSealer) Open(index uint32, final bool, envelope []byte) ([]byte, error) {
+	if len(envelope) == 0 {
+		return nil, ErrEnvelopeShort
+	}
+	if envelope[0] != EnvelopeChunk {
+		return nil, ErrEnvelopeVersion
+	}
+
+	rest := envelope[1:]
+	if len(rest) < c.aead.NonceSize()+c.aead.Overhead() {
+		return nil, ErrEnvelopeShort
+	}
+
+	nonce, ciphertext := rest[:c.aead.NonceSize()], rest[c.aead.NonceSize():]
+	chunk, err := c.aead.Open(nil, nonce, ciphertext, c.additional(index, final))
+	if err != nil {
+		return nil, ErrEnvelopeOpen
+	}
+
+	return chunk, nil
+}
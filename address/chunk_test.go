@@ -0,0 +1,43 @@
+package address
+
+import (
+	"testing"
+)
+
+func TestChunkSealer(t *testing.T) {
+	key := make([]byte, 32)
+	key[0] = 1
+	c, err := NewChunkSealer(key, []byte("attachment 1"))
+	if err != nil {
+		t.Fatal("error creating chunk sealer", err)
+	}
+
+	envelope, err := c.Seal(2, true, []byte("last chunk"))
+	if err != nil {
+		t.Fatal("error sealing", err)
+	}
+	if v, _ := EnvelopeVersion(envelope); v != EnvelopeChunk {
+		t.Errorf("expected version %d, got %d", EnvelopeChunk, v)
+	}
+
+	if chunk, err := c.Open(2, true, envelope); err != nil || string(chunk) != "last chunk" {
+		t.Errorf("expected last chunk, got %q, %v", chunk, err)
+	}
+
+	other, _ := NewChunkSealer(key, []byte("attachment 2"))
+	tests := []struct {
+		name   string
+		sealer *ChunkSealer
+		index  uint32
+		final  bool
+	}{
+		{"moved", c, 1, true},
+		{"not final", c, 2, false},
+		{"other attachment", other, 2, true},
+	}
+	for _, test := range tests {
+		if _, err := test.sealer.Open(test.index, test.final, envelope); err != ErrEnvelopeOpen {
+			t.Errorf("%s: expected ErrEnvelopeOpen, got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// fingerprintInfo separates fingerprint hashes from other uses of the keys.
+const fingerprintInfo = "streammail/v1/fingerprint"
+
+// FingerprintGroups is the number of 5 digit groups in a fingerprint.
+const FingerprintGroups = 6
+
+// Fingerprint returns the safety number of the public keys a and b, for
+// the two parties of a stream to compare in person or over another
+// channel. It is the same whichever order the keys are given in, so both
+// parties see the same number. If someone swapped a key in transit, the
+// numbers differ.
+//
+// The number is FingerprintGroups groups of 5 digits, separated by spaces,
+// taken from SHA512(info || key || key) with the compressed keys sorted.
+func Fingerprint(a, b *Public) (string, error) {
+	if a == nil || a.key == nil || b == nil || b.key == nil {
+		return "", ErrPublicInvalid
+	}
+	if a.Type() != b.Type() {
+		return "", ErrKeyMismatch
+	}
+
+	first, second := a.MarshalCompressed(), b.MarshalCompressed()
+	if bytes.Compare(first, second) > 0 {
+		first, second = second, first
+	}
+
+	h := sha512.New()
+	h.Write([]byte(fingerprintInfo))
+	h.Write(first)
+	h.Write(second)
+	digest := h.Sum(nil)
+
+	groups := make([]string, FingerprintGroups)
+	for i := range groups {
+		// 5 bytes make a 40 bit number, reduced to 5 digits
+		chunk := make([]byte, 8)
+		copy(chunk[3:], digest[i*5:i*5+5])
+		groups[i] = fmt.Sprintf("%05d", binary.BigEndian.Uint64(chunk)%100000)
+	}
+
+	return strings.Join(groups, " "), nil
+}
+
+// Fingerprint returns the safety number of k and the owner of p.
+func (k *Key) Fingerprint(p *Public) (string, error) {
+	return Fingerprint(&k.Public, p)
+}
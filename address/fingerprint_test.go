@@ -0,0 +1,56 @@
+package address
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	format := regexp.MustCompile(`^[0-9]{5}( [0-9]{5}){5}$`)
+
+	for _, keyType := range []KeyType{P256, X25519} {
+		alice, _ := NewKeyType(keyType)
+		bob, _ := NewKeyType(keyType)
+		mallory, _ := NewKeyType(keyType)
+
+		fingerprint1, err := alice.Fingerprint(bob.PublicKey())
+		if err != nil {
+			t.Fatalf("%v: error getting fingerprint: %v", keyType, err)
+		}
+
+		fingerprint2, err := bob.Fingerprint(alice.PublicKey())
+		if err != nil {
+			t.Fatalf("%v: error getting fingerprint: %v", keyType, err)
+		}
+
+		if fingerprint1 != fingerprint2 {
+			t.Errorf("%v: fingerprints do not match: %s, %s", keyType, fingerprint1, fingerprint2)
+		}
+		if !format.MatchString(fingerprint1) {
+			t.Errorf("%v: unexpected fingerprint format %q", keyType, fingerprint1)
+		}
+
+		// the same whether bob's key came with its signing key or not
+		imported, _ := UnmarshalPublic(keyType, bob.Marshal())
+		if fingerprint3, _ := alice.Fingerprint(imported); fingerprint3 != fingerprint1 {
+			t.Errorf("%v: fingerprint depends on the signing key: %s, %s", keyType, fingerprint1, fingerprint3)
+		}
+
+		swapped, _ := alice.Fingerprint(mallory.PublicKey())
+		if swapped == fingerprint1 {
+			t.Errorf("%v: fingerprint does not depend on the peer's key", keyType)
+		}
+	}
+}
+
+func TestFingerprintInvalid(t *testing.T) {
+	p256, _ := NewKey()
+	x25519, _ := NewKeyType(X25519)
+
+	if _, err := p256.Fingerprint(x25519.PublicKey()); err != ErrKeyMismatch {
+		t.Errorf("expected ErrKeyMismatch, got %v", err)
+	}
+	if _, err := p256.Fingerprint(nil); err != ErrPublicInvalid {
+		t.Errorf("expected ErrPublicInvalid, got %v", err)
+	}
+}
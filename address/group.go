@@ -0,0 +1,95 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+
+	b58 "github.com/jbenet/go-base58"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// GroupKeySize is the size of the secret of a GroupKey.
+const GroupKeySize = 32
+
+var ErrGroupKey = errors.New("invalid group key")
+
+// A GroupKey is the secret of a stream among more than two parties.
+// Instead of coming from ECDH it is random, and handed to each member
+// over the stream they share with whoever created it. Its address,
+// message key and auth key are derived as for two party streams.
+type GroupKey struct {
+	secret []byte
+}
+
+// NewGroupKey creates a random GroupKey.
+func NewGroupKey() (*GroupKey, error) {
+	secret := make([]byte, GroupKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &GroupKey{secret}, nil
+}
+
+// ParseGroupKey decodes the text form of a GroupKey made by String.
+func ParseGroupKey(s string) (*GroupKey, error) {
+	raw := b58.Decode(s)
+	if len(raw) != GroupKeySize+4 {
+		return nil, ErrGroupKey
+	}
+
+	sum := checksum(raw[:GroupKeySize])
+	if !bytes.Equal(sum[:], raw[GroupKeySize:]) {
+		return nil, ErrGroupKey
+	}
+
+	return &GroupKey{raw[:GroupKeySize]}, nil
+}
+
+// String returns g in base58 with a 4 byte checksum, as in addresses.
+// It is the secret of the group, to be sent sealed only.
+func (g *GroupKey) String() string {
+	return base58EncodeCheck(append([]byte{}, g.secret...))
+}
+
+// Address returns the GroupVersion address of the group stream,
+// hashed from the secret as X25519 addresses are.
+func (g *GroupKey) Address() string {
+	digest := sha256.Sum256(g.secret)
+
+	ripe := ripemd160.New()
+	ripe.Write(digest[:])
+	a := Address{Version: GroupVersion}
+	copy(a.Hash[:], ripe.Sum(nil))
+
+	return a.String()
+}
+
+// Sealer returns the Sealer of the group's messages.
+func (g *GroupKey) Sealer() (*Sealer, error) {
+	key, err := expand(g.secret, messageKeyInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSealer(key)
+}
+
+// AuthKey returns the signing key of requests for the group stream,
+// see Key.AuthKey.
+func (g *GroupKey) AuthKey() (ed25519.PrivateKey, error) {
+	seed, err := expand(g.secret, authKeyInfo, ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
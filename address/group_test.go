@@ -0,0 +1,44 @@
+package address
+
+import (
+	"testing"
+)
+
+func TestGroupKey(t *testing.T) {
+	g, err := NewGroupKey()
+	if err != nil {
+		t.Fatal("error creating group key", err)
+	}
+
+	a, err := Parse(g.Address())
+	if err != nil {
+		t.Fatal("error parsing group address", err)
+	}
+	if a.Version != GroupVersion {
+		t.Errorf("expected version %d, got %d", GroupVersion, a.Version)
+	}
+
+	parsed, err := ParseGroupKey(g.String())
+	if err != nil {
+		t.Fatal("error parsing group key", err)
+	}
+	if parsed.Address() != g.Address() {
+		t.Error("parsed group key has a different address")
+	}
+
+	sealer, _ := g.Sealer()
+	other, _ := parsed.Sealer()
+	envelope, _ := sealer.Seal([]byte("hello group"))
+	if message, err := other.Open(envelope); err != nil || string(message) != "hello group" {
+		t.Errorf("expected hello group, got %q, %v", message, err)
+	}
+
+	another, _ := NewGroupKey()
+	if another.Address() == g.Address() {
+		t.Error("group keys share an address")
+	}
+
+	if _, err := ParseGroupKey(g.Address()); err != ErrGroupKey {
+		t.Error("expected ErrGroupKey, got", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// info strings used with HKDF to derive keys from a seed. Index keys and
+// contact keys use different strings so they can never collide.
+const (
+	seedKeyInfo    = "streammail/v1/seed-key"
+	contactKeyInfo = "streammail/v1/contact-key"
+)
+
+var ErrSeedLength = errors.New("seed must be at least 16 bytes")
+
+// Keychain derives Keys from a seed, so all of them can be restored on
+// another device from the seed's mnemonic. The same seed, KeyType and
+// index or contact always give the same Key.
+type Keychain struct {
+	seed []byte
+}
+
+// NewKeychain creates a Keychain from seed, such as one returned by
+// MnemonicSeed.
+func NewKeychain(seed []byte) (*Keychain, error) {
+	if len(seed) < 16 {
+		return nil, ErrSeedLength
+	}
+
+	return &Keychain{append([]byte{}, seed...)}, nil
+}
+
+// RestoreKeychain creates the Keychain of a BIP-39 mnemonic and passphrase.
+func RestoreKeychain(mnemonic, passphrase string) (*Keychain, error) {
+	seed, err := MnemonicSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeychain(seed)
+}
+
+// Key returns the child key of type t numbered index.
+func (kc *Keychain) Key(t KeyType, index uint32) (*Key, error) {
+	label := make([]byte, 4)
+	binary.BigEndian.PutUint32(label, index)
+
+	return kc.derive(seedKeyInfo, t, label)
+}
+
+// ContactKey returns the child key of type t for the stream with contact,
+// any name the user gives the other party. Using a key per contact keeps
+// a user's streams from being linked by a shared public key. The name is
+// needed to restore the key, so it should be kept with the mnemonic.
+func (kc *Keychain) ContactKey(t KeyType, contact string) (*Key, error) {
+	return kc.derive(contactKeyInfo, t, []byte(contact))
+}
+
+// derive expands the seed into a private key of type t with
+// HKDF-SHA256(IKM = seed, INFO = info || t || counter || label).
+// Few 32 byte strings are not valid P-256 scalars; counter is
+// incremented until one is.
+func (kc *Keychain) derive(info string, t KeyType, label []byte) (*Key, error) {
+	var err error
+	for counter := 0; counter < 256; counter++ {
+		full := append([]byte(info), byte(t), byte(counter))
+		full = append(full, label...)
+
+		d := make([]byte, 32)
+		if _, err = io.ReadFull(hkdf.New(sha256.New, kc.seed, nil, full), d); err != nil {
+			return nil, err
+		}
+
+		var priv *ecdh.PrivateKey
+		if priv, err = t.curve().NewPrivateKey(d); err == nil {
+			return newKey(priv), nil
+		}
+	}
+
+	return nil, err
+}
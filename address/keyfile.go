@@ -0,0 +1,306 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PEM block types. Unencrypted private keys are standard PKCS#8 and public
+// keys are standard PKIX, so they can be read by other tools such as openssl.
+// The encrypted form is specific to Stream: the PKCS#8 DER is sealed in an
+// envelope (see Sealer) keyed with scrypt(passphrase, Salt). A public key
+// may be followed by its raw Ed25519 signing key, see Public.SignKey.
+const (
+	privateKeyType          = "PRIVATE KEY"
+	ecPrivateKeyType        = "EC PRIVATE KEY"
+	encryptedPrivateKeyType = "STREAM ENCRYPTED PRIVATE KEY"
+	publicKeyType           = "PUBLIC KEY"
+	signKeyType             = "STREAM SIGNING KEY"
+)
+
+// scrypt parameters for newly encrypted keys.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Largest scrypt parameters accepted from key files, so a corrupt or
+// crafted file cannot make ParseKey take gigabytes or minutes.
+const (
+	maxScryptN  = 1 << 20
+	maxScryptRP = 1 << 8
+)
+
+var (
+	ErrNoPEM      = errors.New("no PEM data found")
+	ErrKeyType    = errors.New("unsupported key type")
+	ErrPassphrase = errors.New("incorrect passphrase")
+	ErrNeedPhrase = errors.New("key is encrypted, passphrase required")
+	ErrKdfParams  = errors.New("invalid or too costly Kdf-Params")
+)
+
+// ecdhPrivate converts a private key parsed by crypto/x509 for use as a
+// Key. P-256 keys come back as ECDSA keys, X25519 keys as ECDH keys.
+func ecdhPrivate(priv interface{}) (*ecdh.PrivateKey, error) {
+	switch priv := priv.(type) {
+	case *ecdsa.PrivateKey:
+		if priv.Curve != elliptic.P256() {
+			return nil, ErrKeyType
+		}
+		return priv.ECDH()
+	case *ecdh.PrivateKey:
+		if priv.Curve() != ecdh.P256() && priv.Curve() != ecdh.X25519() {
+			return nil, ErrKeyType
+		}
+		return priv, nil
+	}
+
+	return nil, ErrKeyType
+}
+
+// ecdhPublic is ecdhPrivate for public keys.
+func ecdhPublic(pub interface{}) (*ecdh.PublicKey, error) {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, ErrKeyType
+		}
+		return pub.ECDH()
+	case *ecdh.PublicKey:
+		if pub.Curve() != ecdh.P256() && pub.Curve() != ecdh.X25519() {
+			return nil, ErrKeyType
+		}
+		return pub, nil
+	}
+
+	return nil, ErrKeyType
+}
+
+// MarshalPEM encodes the private key as a PKCS#8 PEM block.
+// When passphrase is not empty the key is encrypted with it.
+func (k *Key) MarshalPEM(passphrase []byte) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passphrase) == 0 {
+		return pem.EncodeToMemory(&pem.Block{Type: privateKeyType, Bytes: der}), nil
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	sealer, err := passphraseSealer(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := sealer.Seal(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type: encryptedPrivateKeyType,
+		Headers: map[string]string{
+			"Kdf":        "scrypt",
+			"Kdf-Params": fmt.Sprintf("N=%d,r=%d,p=%d", scryptN, scryptR, scryptP),
+			"Salt":       hex.EncodeToString(salt),
+		},
+		Bytes: sealed,
+	}), nil
+}
+
+// passphraseSealer derives a Sealer from a passphrase with scrypt.
+func passphraseSealer(passphrase, salt []byte, n, r, p int) (*Sealer, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSealer(key)
+}
+
+// validScrypt reports whether n, r and p are scrypt parameters that
+// ParseKey accepts: n a power of two above 1, and both n and r×p at
+// most maxScryptN and maxScryptRP.
+func validScrypt(n, r, p int) bool {
+	if n <= 1 || n > maxScryptN || n&(n-1) != 0 {
+		return false
+	}
+	if r < 1 || p < 1 || r > maxScryptRP || p > maxScryptRP {
+		return false
+	}
+
+	return r*p <= maxScryptRP
+}
+
+// ParseKey decodes a private key written by MarshalPEM. Unencrypted
+// PKCS#8 P-256 and X25519 keys, and SEC1 ("EC PRIVATE KEY") P-256 keys
+// are also accepted.
+// passphrase is only used when the key is encrypted.
+func ParseKey(data []byte, passphrase []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNoPEM
+	}
+
+	der := block.Bytes
+	switch block.Type {
+	case privateKeyType:
+	case ecPrivateKeyType:
+		priv, err := x509.ParseECPrivateKey(der)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ecdhPrivate(priv)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(key), nil
+	case encryptedPrivateKeyType:
+		if len(passphrase) == 0 {
+			return nil, ErrNeedPhrase
+		}
+
+		var n, r, p int
+		if block.Headers["Kdf"] != "scrypt" {
+			return nil, errors.New("unsupported key derivation function " + block.Headers["Kdf"])
+		}
+		if _, err := fmt.Sscanf(block.Headers["Kdf-Params"], "N=%d,r=%d,p=%d", &n, &r, &p); err != nil {
+			return nil, errors.New("invalid Kdf-Params: " + err.Error())
+		}
+		if !validScrypt(n, r, p) {
+			return nil, ErrKdfParams
+		}
+		salt, err := hex.DecodeString(block.Headers["Salt"])
+		if err != nil {
+			return nil, errors.New("invalid Salt: " + err.Error())
+		}
+
+		sealer, err := passphraseSealer(passphrase, salt, n, r, p)
+		if err != nil {
+			return nil, err
+		}
+
+		der, err = sealer.Open(block.Bytes)
+		if err != nil {
+			return nil, ErrPassphrase
+		}
+	default:
+		return nil, ErrKeyType
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdhPrivate(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKey(key), nil
+}
+
+// Save writes the private key to filename, readable only by its owner.
+// When passphrase is not empty the key is encrypted with it.
+func (k *Key) Save(filename string, passphrase []byte) error {
+	data, err := k.MarshalPEM(passphrase)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, data, 0600)
+}
+
+// LoadKey reads a private key written by Save.
+func LoadKey(filename string, passphrase []byte) (*Key, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKey(data, passphrase)
+}
+
+// MarshalPEM encodes the public key as a PKIX PEM block, suitable
+// for handing to the other party of a stream. The signing key, when
+// known, follows in a block of its own, which other tools skip.
+func (p *Public) MarshalPEM() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(p.key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: publicKeyType, Bytes: der})
+	if p.sign != nil {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: signKeyType, Bytes: p.sign})...)
+	}
+
+	return data, nil
+}
+
+// ParsePublicPEM decodes a PKIX PEM public key, such as one written
+// by Public.MarshalPEM.
+func ParsePublicPEM(data []byte) (*Public, error) {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNoPEM
+	}
+
+	if block.Type != publicKeyType {
+		return nil, ErrKeyType
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdhPublic(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Public{key: key}
+	if block, _ := pem.Decode(rest); block != nil && block.Type == signKeyType {
+		if len(block.Bytes) != ed25519.PublicKeySize {
+			return nil, ErrNoSignKey
+		}
+		p.sign = ed25519.PublicKey(block.Bytes)
+	}
+
+	return p, nil
+}
+
+// LoadPublic reads a peer's public key from a PEM file.
+func LoadPublic(filename string) (*Public, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePublicPEM(data)
+}
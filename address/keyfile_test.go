@@ -0,0 +1,117 @@
+package address
+
+import (
+	"bytes"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyFile(t *testing.T) {
+	alice, bob := newPair(t)
+	want, _ := alice.Address(&bob.Public)
+
+	filename := filepath.Join(t.TempDir(), "alice.pem")
+	if err := alice.Save(filename, nil); err != nil {
+		t.Fatal("error saving key", err)
+	}
+
+	loaded, err := LoadKey(filename, nil)
+	if err != nil {
+		t.Fatal("error loading key", err)
+	}
+
+	if !bytes.Equal(loaded.Marshal(), alice.Marshal()) {
+		t.Error("public keys do not match")
+	}
+
+	got, err := loaded.Address(&bob.Public)
+	if err != nil {
+		t.Fatal("error getting address", err)
+	}
+
+	if got != want {
+		t.Errorf("expected address [%s], got [%s]", want, got)
+	}
+}
+
+func TestKeyFileEncrypted(t *testing.T) {
+	alice, _ := newPair(t)
+	passphrase := []byte("correct horse battery staple")
+
+	data, err := alice.MarshalPEM(passphrase)
+	if err != nil {
+		t.Fatal("error marshaling key", err)
+	}
+
+	if _, err := ParseKey(data, nil); err != ErrNeedPhrase {
+		t.Error("expected ErrNeedPhrase, got", err)
+	}
+
+	if _, err := ParseKey(data, []byte("wrong")); err != ErrPassphrase {
+		t.Error("expected ErrPassphrase, got", err)
+	}
+
+	loaded, err := ParseKey(data, passphrase)
+	if err != nil {
+		t.Fatal("error parsing key", err)
+	}
+
+	if !bytes.Equal(loaded.Marshal(), alice.Marshal()) {
+		t.Error("public keys do not match")
+	}
+}
+
+func TestKeyFileKdfParams(t *testing.T) {
+	alice, _ := newPair(t)
+	passphrase := []byte("correct horse battery staple")
+
+	data, err := alice.MarshalPEM(passphrase)
+	if err != nil {
+		t.Fatal("error marshaling key", err)
+	}
+	block, _ := pem.Decode(data)
+
+	for _, params := range []string{
+		"N=2097152,r=8,p=1", // N too large
+		"N=32768,r=64,p=8",  // r×p too large
+		"N=1,r=8,p=1",
+		"N=32767,r=8,p=1", // not a power of two
+		"N=32768,r=0,p=1",
+	} {
+		block.Headers["Kdf-Params"] = params
+		if _, err := ParseKey(pem.EncodeToMemory(block), passphrase); err != ErrKdfParams {
+			t.Errorf("%s: expected ErrKdfParams, got %v", params, err)
+		}
+	}
+}
+
+func TestPublicFile(t *testing.T) {
+	alice, bob := newPair(t)
+
+	data, err := bob.PublicKey().MarshalPEM()
+	if err != nil {
+		t.Fatal("error marshaling public key", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "bob.pub")
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	peer, err := LoadPublic(filename)
+	if err != nil {
+		t.Fatal("error loading public key", err)
+	}
+
+	address1, _ := alice.Address(peer)
+	address2, _ := bob.Address(&alice.Public)
+	if address1 != address2 {
+		t.Error("addresses do not match")
+	}
+
+	if _, err := ParsePublicPEM([]byte("garbage")); err != ErrNoPEM {
+		t.Error("expected ErrNoPEM, got", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Errors returned for entropy or mnemonics outside BIP-39.
+var (
+	ErrEntropyLength    = errors.New("entropy must be 128 to 256 bits, in steps of 32")
+	ErrMnemonicLength   = errors.New("mnemonic must have 12, 15, 18, 21 or 24 words")
+	ErrMnemonicWord     = errors.New("mnemonic has a word not in the word list")
+	ErrMnemonicChecksum = errors.New("mnemonic checksum does not match")
+)
+
+// NewMnemonic returns a BIP-39 mnemonic for bits of random entropy.
+// 128 bits make 12 words, 256 bits make 24.
+func NewMnemonic(bits int) (string, error) {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", ErrEntropyLength
+	}
+
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+
+	return EntropyMnemonic(entropy)
+}
+
+// EntropyMnemonic encodes entropy as a BIP-39 mnemonic: the entropy
+// followed by the first len(entropy)/4 bits of its SHA256, as 11 bit
+// indexes into the English word list.
+func EntropyMnemonic(entropy []byte) (string, error) {
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return "", ErrEntropyLength
+	}
+
+	sum := sha256.Sum256(entropy)
+	data := append(append([]byte{}, entropy...), sum[0])
+
+	words := make([]string, (len(entropy)*8+len(entropy)/4)/11)
+	for i := range words {
+		words[i] = wordlist[bits(data, i*11, 11)]
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicEntropy decodes a mnemonic made by EntropyMnemonic.
+func MnemonicEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return nil, ErrMnemonicLength
+	}
+
+	// 11 bits a word, of which one in 33 is checksum
+	data := make([]byte, (len(words)*11+7)/8)
+	for i, word := range words {
+		index, ok := wordIndex(word)
+		if !ok {
+			return nil, ErrMnemonicWord
+		}
+
+		for j := 0; j < 11; j++ {
+			if index&(1<<uint(10-j)) != 0 {
+				n := i*11 + j
+				data[n/8] |= 0x80 >> uint(n%8)
+			}
+		}
+	}
+
+	size := len(words) * 11 * 32 / 33 / 8
+	entropy := data[:size]
+	sum := sha256.Sum256(entropy)
+	if bits(data, size*8, size/4) != bits(sum[:], 0, size/4) {
+		return nil, ErrMnemonicChecksum
+	}
+
+	return entropy, nil
+}
+
+// ValidateMnemonic returns the error MnemonicEntropy would for
+// mnemonic, or nil for a valid one.
+func ValidateMnemonic(mnemonic string) error {
+	_, err := MnemonicEntropy(mnemonic)
+	return err
+}
+
+// MnemonicSeed returns the 64 byte BIP-39 seed of mnemonic, protected by
+// passphrase, which may be empty. The passphrase is used as given; BIP-39
+// expects it in Unicode NFKD form.
+func MnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+
+	normal := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(normal), []byte("mnemonic"+passphrase), 2048, 64, sha512.New), nil
+}
+
+// bits returns n bits of data, starting at bit offset from the left.
+func bits(data []byte, offset, n int) int {
+	v := 0
+	for i := offset; i < offset+n; i++ {
+		v <<= 1
+		if data[i/8]&(0x80>>uint(i%8)) != 0 {
+			v |= 1
+		}
+	}
+	return v
+}
+
+// wordIndex returns the position of word in the word list, which is sorted.
+func wordIndex(word string) (int, bool) {
+	i := sort.SearchStrings(wordlist, word)
+	return i, i < len(wordlist) && wordlist[i] == word
+}
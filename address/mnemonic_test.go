@@ -0,0 +1,154 @@
+package address
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+func TestWordlist(t *testing.T) {
+	if len(wordlist) != 2048 {
+		t.Fatalf("expected 2048 words, got %d", len(wordlist))
+	}
+
+	// crc32 of english.txt from the BIP-39 repository
+	if sum := crc32.ChecksumIEEE([]byte(english)); sum != 0xc1dbd296 {
+		t.Errorf("word list checksum is %x", sum)
+	}
+}
+
+// From the BIP-39 test vectors, all with the passphrase "TREZOR".
+var mnemonicTests = []struct {
+	entropy  string
+	mnemonic string
+	seed     string
+}{
+	{
+		"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+	},
+	{
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+		"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+	},
+}
+
+func TestMnemonic(t *testing.T) {
+	for _, test := range mnemonicTests {
+		entropy, _ := hex.DecodeString(test.entropy)
+
+		mnemonic, err := EntropyMnemonic(entropy)
+		if err != nil {
+			t.Fatalf("%s: error making mnemonic: %v", test.entropy, err)
+		}
+		if mnemonic != test.mnemonic {
+			t.Errorf("%s: mnemonic is %q", test.entropy, mnemonic)
+		}
+
+		decoded, err := MnemonicEntropy(test.mnemonic)
+		if err != nil || !bytes.Equal(decoded, entropy) {
+			t.Errorf("%s: decoded entropy %x, error %v", test.entropy, decoded, err)
+		}
+
+		seed, err := MnemonicSeed(test.mnemonic, "TREZOR")
+		if err != nil {
+			t.Fatalf("%s: error making seed: %v", test.entropy, err)
+		}
+		if hex.EncodeToString(seed) != test.seed {
+			t.Errorf("%s: seed is %x", test.entropy, seed)
+		}
+	}
+}
+
+func TestNewMnemonic(t *testing.T) {
+	for _, bits := range []int{128, 160, 192, 224, 256} {
+		mnemonic, err := NewMnemonic(bits)
+		if err != nil {
+			t.Fatalf("%d: error making mnemonic: %v", bits, err)
+		}
+		if words := len(strings.Fields(mnemonic)); words != bits*33/32/11 {
+			t.Errorf("%d: expected %d words, got %d", bits, bits*33/32/11, words)
+		}
+		if err := ValidateMnemonic(mnemonic); err != nil {
+			t.Errorf("%d: %v", bits, err)
+		}
+	}
+
+	if _, err := NewMnemonic(100); err != ErrEntropyLength {
+		t.Errorf("expected ErrEntropyLength, got %v", err)
+	}
+}
+
+func TestMnemonicInvalid(t *testing.T) {
+	tests := []struct {
+		mnemonic string
+		err      error
+	}{
+		{"abandon abandon abandon", ErrMnemonicLength},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon streammail", ErrMnemonicWord},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", ErrMnemonicChecksum},
+	}
+
+	for _, test := range tests {
+		if err := ValidateMnemonic(test.mnemonic); err != test.err {
+			t.Errorf("%q: expected %v, got %v", test.mnemonic, test.err, err)
+		}
+	}
+}
+
+func TestKeychain(t *testing.T) {
+	mnemonic := mnemonicTests[1].mnemonic
+
+	kc1, err := RestoreKeychain(mnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kc2, _ := RestoreKeychain(mnemonic, "")
+	other, _ := RestoreKeychain(mnemonic, "TREZOR")
+
+	for _, keyType := range []KeyType{P256, X25519} {
+		key1, err := kc1.Key(keyType, 0)
+		if err != nil {
+			t.Fatalf("%v: error deriving key: %v", keyType, err)
+		}
+		key2, _ := kc2.Key(keyType, 0)
+		if key1.Type() != keyType || !bytes.Equal(key1.Marshal(), key2.Marshal()) {
+			t.Errorf("%v: restored keys do not match", keyType)
+		}
+
+		next, _ := kc1.Key(keyType, 1)
+		contact, _ := kc1.ContactKey(keyType, "bob")
+		restored, _ := kc2.ContactKey(keyType, "bob")
+		passphrase, _ := other.Key(keyType, 0)
+		if !bytes.Equal(contact.Marshal(), restored.Marshal()) {
+			t.Errorf("%v: restored contact keys do not match", keyType)
+		}
+
+		for _, k := range []*Key{next, contact, passphrase} {
+			if bytes.Equal(k.Marshal(), key1.Marshal()) {
+				t.Errorf("%v: expected different keys", keyType)
+			}
+		}
+
+		// a stream restored on a new device has the same address
+		peer, _ := NewKeyType(keyType)
+		address1, _ := contact.Address(peer.PublicKey())
+		address2, _ := restored.Address(peer.PublicKey())
+		if address1 != address2 {
+			t.Errorf("%v: addresses do not match", keyType)
+		}
+	}
+
+	if _, err := NewKeychain([]byte("short")); err != ErrSeedLength {
+		t.Errorf("expected ErrSeedLength, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"math/big"
+)
+
+// crypto/ecdh does not decompress P-256 keys, nor give the Y of a
+// shared point, which P-256 addresses hash. Both are done here.
+var p256 = elliptic.P256().Params()
+
+// p256Y returns the y of the point with x whose lowest bit is odd,
+// or nil when x is not on the curve. It is not constant time, and
+// only for public keys.
+func p256Y(x *big.Int, odd bool) *big.Int {
+	if x.Sign() < 0 || x.Cmp(p256.P) >= 0 {
+		return nil
+	}
+
+	three := big.NewInt(3)
+	y2 := new(big.Int).Exp(x, three, p256.P)
+	y2.Sub(y2, new(big.Int).Mul(three, x))
+	y2.Add(y2, p256.B)
+	y2.Mod(y2, p256.P)
+
+	y := new(big.Int).ModSqrt(y2, p256.P)
+	if y == nil {
+		return nil
+	}
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(p256.P, y)
+	}
+
+	return y
+}
+
+// p256Shared returns the coordinates of the point private·public.
+// crypto/ecdh would give only X, so it uses the constant time P-256
+// scalar multiplication of crypto/elliptic, deprecated for ECDH only
+// because it returns Y too, which is what is needed here.
+func p256Shared(private *ecdh.PrivateKey, public *ecdh.PublicKey) (*big.Int, *big.Int) {
+	raw := public.Bytes() // 0x04 || X || Y, on the curve
+	qx, qy := new(big.Int).SetBytes(raw[1:33]), new(big.Int).SetBytes(raw[33:])
+
+	//lint:ignore SA1019 constant time for P-256, and crypto/ecdh hides Y
+	return elliptic.P256().ScalarMult(qx, qy, private.Bytes())
+}
+
+// p256Bytes returns the uncompressed form of a point, 0x04 || X || Y.
+func p256Bytes(x, y *big.Int) []byte {
+	raw := make([]byte, 65)
+	raw[0] = 0x04
+	x.FillBytes(raw[1:33])
+	y.FillBytes(raw[33:])
+	return raw
+}
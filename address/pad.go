@@ -0,0 +1,94 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+var ErrPadding = errors.New("invalid padding")
+
+// A Padding chooses the size messages are padded to before they are
+// sealed, so that envelopes do not tell the exact size of messages.
+type Padding interface {
+	// Size returns the padded size of n bytes, at least n.
+	Size(n int) (int, error)
+}
+
+// PowerOfTwoPadding pads to the next power of two, and to at least its
+// own value. Envelopes tell only roughly how large a message is, at the
+// cost of up to doubling it.
+type PowerOfTwoPadding int
+
+func (p PowerOfTwoPadding) Size(n int) (int, error) {
+	size := 1
+	for size < n || size < int(p) {
+		size *= 2
+	}
+
+	return size, nil
+}
+
+// BlockPadding pads to a multiple of its value, hiding differences
+// smaller than the block.
+type BlockPadding int
+
+func (p BlockPadding) Size(n int) (int, error) {
+	if p <= 0 {
+		return 0, ErrPadding
+	}
+
+	block := int(p)
+	return (n + block - 1) / block * block, nil
+}
+
+// RandomPadding adds from zero up to its value of random bytes, so the
+// same message is not always the same size.
+type RandomPadding int
+
+func (p RandomPadding) Size(n int) (int, error) {
+	if p < 0 {
+		return 0, ErrPadding
+	}
+
+	extra, err := rand.Int(rand.Reader, big.NewInt(int64(p)+1))
+	if err != nil {
+		return 0, err
+	}
+
+	return n + int(extra.Int64()), nil
+}
+
+// Pad returns message padded as chosen by p: message, a 0x80 byte,
+// then zeros.
+func Pad(message []byte, p Padding) ([]byte, error) {
+	size, err := p.Size(len(message) + 1)
+	if err != nil {
+		return nil, err
+	}
+	if size < len(message)+1 {
+		return nil, ErrPadding
+	}
+
+	padded := make([]byte, size)
+	copy(padded, message)
+	padded[len(message)] = 0x80
+	return padded, nil
+}
+
+// Unpad returns the message that Pad padded.
+func Unpad(padded []byte) ([]byte, error) {
+	i := len(padded) - 1
+	for i >= 0 && padded[i] == 0 {
+		i--
+	}
+	if i < 0 || padded[i] != 0x80 {
+		return nil, ErrPadding
+	}
+
+	return padded[:i], nil
+}
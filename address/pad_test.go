@@ -0,0 +1,62 @@
+package address
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPaddingSize(t *testing.T) {
+	tests := []struct {
+		padding Padding
+		n       int
+		size    int
+	}{
+		{PowerOfTwoPadding(0), 1, 1},
+		{PowerOfTwoPadding(0), 100, 128},
+		{PowerOfTwoPadding(0), 128, 128},
+		{PowerOfTwoPadding(256), 100, 256},
+		{PowerOfTwoPadding(256), 300, 512},
+		{BlockPadding(64), 1, 64},
+		{BlockPadding(64), 64, 64},
+		{BlockPadding(64), 65, 128},
+		{RandomPadding(0), 10, 10},
+	}
+	for _, test := range tests {
+		if size, err := test.padding.Size(test.n); err != nil || size != test.size {
+			t.Errorf("%T(%v) of %d: expected %d, got %d, %v", test.padding, test.padding, test.n, test.size, size, err)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		if size, err := RandomPadding(16).Size(10); err != nil || size < 10 || size > 26 {
+			t.Fatal("random padding out of range", size, err)
+		}
+	}
+
+	if _, err := BlockPadding(0).Size(10); err != ErrPadding {
+		t.Error("expected ErrPadding, got", err)
+	}
+}
+
+func TestPad(t *testing.T) {
+	for _, message := range [][]byte{{}, []byte("hello"), {0xc3}, {0x80, 0}} {
+		padded, err := Pad(message, BlockPadding(16))
+		if err != nil {
+			t.Fatal("error padding", err)
+		}
+		if len(padded) != 16 {
+			t.Errorf("expected 16 bytes, got %d", len(padded))
+		}
+
+		unpadded, err := Unpad(padded)
+		if err != nil || !bytes.Equal(unpadded, message) {
+			t.Errorf("expected %x, got %x, %v", message, unpadded, err)
+		}
+	}
+
+	for _, padded := range [][]byte{{}, {0, 0}, {'a', 0}} {
+		if _, err := Unpad(padded); err != ErrPadding {
+			t.Errorf("%x: expected ErrPadding, got %v", padded, err)
+		}
+	}
+}
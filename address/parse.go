@@ -0,0 +1,92 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	b58 "github.com/jbenet/go-base58"
+)
+
+// Errors returned by Parse, from the first check an address fails.
+var (
+	ErrEncoding = errors.New("address is not base58")
+	ErrLength   = errors.New("address has the wrong length")
+	ErrVersion  = errors.New("address not a STREAM address")
+	ErrChecksum = errors.New("address checksum does not match")
+)
+
+// Address is a decoded Stream address: a version byte, the hash of
+// the ECDH secret it was derived from and a checksum over both.
+type Address struct {
+	// Version is the route prefix of the address, see LookupVersion.
+	Version byte
+
+	// Hash is RIPEMD160(SHA256(secret)).
+	Hash [20]byte
+
+	// Checksum is as found in the address. ChecksumOK tells whether
+	// it matches the first 4 bytes of SHA256(SHA256(Version || Hash)).
+	Checksum   [4]byte
+	ChecksumOK bool
+}
+
+// Parse decodes s as a Stream address. When only the checksum is
+// wrong, the decoded Address is returned along with ErrChecksum,
+// so it can still be inspected.
+func Parse(s string) (Address, error) {
+	var a Address
+
+	raw := b58.Decode(s)
+	if len(raw) == 0 {
+		return a, ErrEncoding
+	}
+	if len(raw) != 1+len(a.Hash)+len(a.Checksum) {
+		return a, ErrLength
+	}
+	if _, ok := LookupVersion(raw[0]); !ok {
+		return a, ErrVersion
+	}
+
+	a.Version = raw[0]
+	copy(a.Hash[:], raw[1:])
+	copy(a.Checksum[:], raw[1+len(a.Hash):])
+
+	sum := checksum(raw[:1+len(a.Hash)])
+	a.ChecksumOK = bytes.Equal(sum[:], a.Checksum[:])
+	if !a.ChecksumOK {
+		return a, ErrChecksum
+	}
+
+	return a, nil
+}
+
+// Format returns the Version of a. Parse only returns
+// addresses of registered versions.
+func (a Address) Format() Version {
+	v, _ := LookupVersion(a.Version)
+	return v
+}
+
+// Validate returns the error Parse would for s, or nil for a valid address.
+func Validate(s string) error {
+	_, err := Parse(s)
+	return err
+}
+
+// String encodes a in base58, with a correct checksum.
+func (a Address) String() string {
+	return base58EncodeCheck(append([]byte{a.Version}, a.Hash[:]...))
+}
+
+// checksum returns the first 4 bytes of SHA256(SHA256(data)).
+func checksum(data []byte) (sum [4]byte) {
+	digest := sha256.Sum256(data)
+	digest = sha256.Sum256(digest[:])
+	copy(sum[:], digest[:])
+	return sum
+}
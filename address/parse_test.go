@@ -0,0 +1,48 @@
+package address
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	alice, _ := NewKey()
+	bob, _ := NewKey()
+	s, err := alice.Address(bob.PublicKey())
+	if err != nil {
+		t.Fatal("error getting address", err)
+	}
+
+	a, err := Parse(s)
+	if err != nil {
+		t.Fatal("error parsing address", err)
+	}
+	if a.Version != StreamVersion || !a.ChecksumOK {
+		t.Errorf("unexpected address %+v", a)
+	}
+	if a.String() != s {
+		t.Errorf("expected %s, got %s", s, a.String())
+	}
+
+	tests := []struct {
+		address string
+		err     error
+	}{
+		{"SFwExaKH1iu2iK9gW3W2dnRQZewcmGkv6q", nil},
+		{"", ErrEncoding},
+		{"SFwExaKH1iu2iK9gW3W2dnRQZewcmGkv60", ErrEncoding},
+		{"SFwExaKH1iu2iK9gW3W2dnRQ", ErrLength},
+		{"1FwExaKH1iu2iK9gW3W2dnRQZewcmGkv6q", ErrVersion},
+		{"SFwExaKH1iuZiK9gW3W2dnRQZewcmGkv6q", ErrChecksum},
+	}
+	for _, test := range tests {
+		if err := Validate(test.address); err != test.err {
+			t.Errorf("%q: expected %v, got %v", test.address, test.err, err)
+		}
+	}
+
+	// a bad checksum can still be inspected
+	a, _ = Parse("SFwExaKH1iuZiK9gW3W2dnRQZewcmGkv6q")
+	if a.ChecksumOK || a.Version != StreamVersion {
+		t.Errorf("unexpected address %+v", a)
+	}
+}
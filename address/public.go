@@ -0,0 +1,114 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"math/big"
+
+	b58 "github.com/jbenet/go-base58"
+)
+
+var (
+	ErrPublicLength  = errors.New("public key has the wrong length")
+	ErrPublicInvalid = errors.New("invalid public key")
+)
+
+// Marshal returns p in the form described by Key.Marshal.
+func (p *Public) Marshal() []byte {
+	return p.key.Bytes()
+}
+
+// MarshalCompressed returns p in the compressed form of SEC 1, section
+// 2.3.3: 0x02 or 0x03, for an even or odd y, followed by x. X25519 keys
+// have no shorter form and are returned as by Marshal.
+func (p *Public) MarshalCompressed() []byte {
+	raw := p.key.Bytes()
+	if p.Type() == X25519 {
+		return raw
+	}
+
+	// raw is 0x04 || X || Y
+	size := (len(raw) - 1) / 2
+	return append([]byte{0x02 | raw[len(raw)-1]&1}, raw[1:1+size]...)
+}
+
+// UnmarshalPublic decodes a public key of type t. P-256 keys may be
+// compressed or uncompressed. An error is returned for input of the
+// wrong length or that is not a point on the curve.
+func UnmarshalPublic(t KeyType, data []byte) (*Public, error) {
+	if t == P256 {
+		switch {
+		case len(data) == 33 && (data[0] == 0x02 || data[0] == 0x03):
+			x := new(big.Int).SetBytes(data[1:])
+			y := p256Y(x, data[0] == 0x03)
+			if y == nil {
+				return nil, ErrPublicInvalid
+			}
+			data = p256Bytes(x, y)
+		case len(data) == 65 && data[0] == 0x04:
+		case len(data) == 33 || len(data) == 65:
+			return nil, ErrPublicInvalid
+		default:
+			return nil, ErrPublicLength
+		}
+	} else if len(data) != 32 {
+		return nil, ErrPublicLength
+	}
+
+	key, err := t.curve().NewPublicKey(data)
+	if err != nil {
+		return nil, ErrPublicInvalid
+	}
+
+	return &Public{key: key}, nil
+}
+
+// String returns the text form of p, for sharing it where PEM is
+// unwieldy: its compressed form, followed by its signing key when
+// known, in base58 with a 4 byte checksum, as in addresses. The length
+// of the key tells P-256 from X25519.
+func (p *Public) String() string {
+	return base58EncodeCheck(append(p.MarshalCompressed(), p.sign...))
+}
+
+// ParsePublic decodes the text form of a public key made by String.
+func ParsePublic(s string) (*Public, error) {
+	raw := b58.Decode(s)
+	if len(raw) < 4 {
+		return nil, ErrPublicLength
+	}
+
+	data, sum := raw[:len(raw)-4], raw[len(raw)-4:]
+	if want := checksum(data); string(want[:]) != string(sum) {
+		return nil, ErrChecksum
+	}
+
+	// a signing key follows the key, unless this is an
+	// uncompressed P-256 key of the same length
+	var sign []byte
+	switch len(data) {
+	case 32 + ed25519.PublicKeySize:
+		data, sign = data[:32], data[32:]
+	case 33 + ed25519.PublicKeySize:
+		if data[0] != 0x04 {
+			data, sign = data[:33], data[33:]
+		}
+	}
+
+	t := P256
+	if len(data) == 32 {
+		t = X25519
+	}
+
+	p, err := UnmarshalPublic(t, data)
+	if err != nil {
+		return nil, err
+	}
+
+	p.sign = ed25519.PublicKey(sign)
+	return p, nil
+}
@@ -0,0 +1,63 @@
+package address
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPublicCompressed(t *testing.T) {
+	for _, keyType := range []KeyType{P256, X25519} {
+		key, _ := NewKeyType(keyType)
+		compressed := key.PublicKey().MarshalCompressed()
+
+		p, err := key.UnMarshal(compressed)
+		if err != nil {
+			t.Fatalf("%v: error unmarshaling compressed key: %v", keyType, err)
+		}
+		if !bytes.Equal(p.Marshal(), key.Marshal()) {
+			t.Errorf("%v: keys do not match", keyType)
+		}
+
+		p, err = ParsePublic(key.PublicKey().String())
+		if err != nil {
+			t.Fatalf("%v: error parsing text key: %v", keyType, err)
+		}
+		if p.Type() != keyType || !bytes.Equal(p.Marshal(), key.Marshal()) {
+			t.Errorf("%v: keys do not match", keyType)
+		}
+	}
+
+	key, _ := NewKey()
+	if len(key.PublicKey().MarshalCompressed()) != 33 {
+		t.Error("expected a 33 byte compressed P-256 key")
+	}
+}
+
+func TestUnmarshalPublicInvalid(t *testing.T) {
+	key, _ := NewKey()
+	uncompressed := key.Marshal()
+
+	offCurve := append([]byte{}, uncompressed...)
+	offCurve[64] ^= 1
+
+	tests := []struct {
+		keyType KeyType
+		data    []byte
+		err     error
+	}{
+		{P256, nil, ErrPublicLength},
+		{P256, uncompressed[:40], ErrPublicLength},
+		{P256, offCurve, ErrPublicInvalid},
+		{P256, append([]byte{0x05}, uncompressed[1:33]...), ErrPublicInvalid},
+		{X25519, uncompressed, ErrPublicLength},
+	}
+	for _, test := range tests {
+		if _, err := UnmarshalPublic(test.keyType, test.data); err != test.err {
+			t.Errorf("%v %x: expected %v, got %v", test.keyType, test.data, test.err, err)
+		}
+	}
+
+	if _, err := ParsePublic("not a key"); err == nil {
+		t.Error("expected an error parsing a bogus key")
+	}
+}
@@ -0,0 +1,439 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// EnvelopeV2 is the version byte of envelopes sealed by a Ratchet:
+//
+//	VERSION[1 byte] || ROLE[1 byte] || RATCHET-KEY[32 bytes] ||
+//	PN[4 bytes] || N[4 bytes] || NONCE[24 bytes] ||
+//	XCHACHA20-POLY1305(MESSAGE)
+//
+// Everything before NONCE is the header, authenticated as additional data.
+const EnvelopeV2 = 0x02
+
+// info strings used with HKDF for the Ratchet.
+const (
+	ratchetRootInfo = "streammail/v1/ratchet-root"
+	ratchetInitInfo = "streammail/v1/ratchet-init"
+	ratchetInfo     = "streammail/v1/ratchet"
+)
+
+// maxSkip is the most message keys a Ratchet keeps for messages that
+// have not arrived yet; past it, the oldest are dropped. It also bounds
+// how far ahead in a chain a message may be.
+const maxSkip = 1000
+
+// ratchetHeaderSize is the size of the EnvelopeV2 header.
+const ratchetHeaderSize = 1 + 1 + 32 + 4 + 4
+
+// Roles of the two parties of a Ratchet.
+const (
+	roleInitiator = 'A'
+	roleResponder = 'B'
+)
+
+var (
+	ErrRatchetWait = errors.New("ratchet: the other party has to send first")
+	ErrOwnMessage  = errors.New("ratchet: message was sent by this party")
+	ErrMessageKey  = errors.New("ratchet: no key for message, it was already read or is too old")
+	ErrSkipped     = errors.New("ratchet: too many messages skipped in a chain")
+)
+
+// A Ratchet seals and opens the messages of a stream with a fresh key
+// each, as in the Double Ratchet of Signal. Every message carries a new
+// X25519 public key of the sender once the other party has replied, so
+// keys for older messages cannot be computed from the current state:
+// a Key or Ratchet compromised later does not expose them.
+//
+// That does not hold for the first messages of the initiator, up to the
+// first reply. The root key and the responder's first ratchet key come
+// from the ECDH secret of the stream, and the initiator's ratchet key is
+// in every header, so either party's Key, compromised later, opens
+// those messages: they have no forward secrecy. ForwardSecret tells
+// when Seal is past them. Each message can be opened once; clients keep
+// what they have read.
+//
+// Both parties create their Ratchet with Key.Ratchet. The one whose
+// public key sorts first is the initiator; the other has to wait for
+// its first message before sending.
+type Ratchet struct {
+	mu sync.Mutex
+	ratchetState
+}
+
+// ratchetState is the state of a Ratchet, copied so a message that fails
+// to open leaves it unchanged.
+type ratchetState struct {
+	role byte
+	dhs  *ecdh.PrivateKey
+	dhr  *ecdh.PublicKey
+
+	rk, cks, ckr []byte
+	ns, nr, pn   uint32
+
+	skipped map[skippedKey][]byte
+	order   []skippedKey // of skipped, oldest first
+}
+
+// skippedKey identifies a message not received yet, by the
+// ratchet key of its chain and its number in the chain.
+type skippedKey struct {
+	dh [32]byte
+	n  uint32
+}
+
+// Ratchet starts a Ratchet for the stream between k and the owner of p.
+func (k *Key) Ratchet(p *Public) (*Ratchet, error) {
+	sk, err := k.derive(p, ratchetRootInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	// the first ratchet key of the responder, known to both
+	seed, err := k.derive(p, ratchetInitInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	initial, err := ecdh.X25519().NewPrivateKey(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Ratchet{}
+	r.rk = sk
+	r.skipped = make(map[skippedKey][]byte)
+
+	if bytes.Compare(k.MarshalCompressed(), p.MarshalCompressed()) > 0 {
+		r.role = roleResponder
+		r.dhs = initial
+		return r, nil
+	}
+
+	r.role = roleInitiator
+	r.dhr = initial.PublicKey()
+	if r.dhs, err = ecdh.X25519().GenerateKey(rand.Reader); err != nil {
+		return nil, err
+	}
+	if r.rk, r.cks, err = r.kdfRoot(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Initiator tells whether this party sends the first message.
+func (r *Ratchet) Initiator() bool {
+	return r.role == roleInitiator
+}
+
+// ForwardSecret tells whether messages sealed now have forward secrecy,
+// which they do once this party has received a message.
+func (r *Ratchet) ForwardSecret() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.ckr != nil
+}
+
+// Seal encrypts message with the next sending key and returns it
+// wrapped in a version 2 envelope.
+func (r *Ratchet) Seal(message []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cks == nil {
+		return nil, ErrRatchetWait
+	}
+
+	header := make([]byte, ratchetHeaderSize)
+	header[0] = EnvelopeV2
+	header[1] = r.role
+	copy(header[2:34], r.dhs.PublicKey().Bytes())
+	binary.BigEndian.PutUint32(header[34:38], r.pn)
+	binary.BigEndian.PutUint32(header[38:42], r.ns)
+
+	var mk []byte
+	mk, r.cks = kdfChain(r.cks)
+	r.ns++
+
+	aead, err := chacha20poly1305.NewX(mk)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	envelope := append(header, nonce...)
+	return aead.Seal(envelope, nonce, message, header), nil
+}
+
+// Open authenticates and decrypts an envelope sealed by the other
+// party's Ratchet. Returns ErrOwnMessage for envelopes sealed by r.
+func (r *Ratchet) Open(envelope []byte) ([]byte, error) {
+	if len(envelope) == 0 {
+		return nil, ErrEnvelopeShort
+	}
+	if envelope[0] != EnvelopeV2 {
+		return nil, ErrEnvelopeVersion
+	}
+	if len(envelope) < ratchetHeaderSize+chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead {
+		return nil, ErrEnvelopeShort
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	header := envelope[:ratchetHeaderSize]
+	if header[1] == r.role {
+		return nil, ErrOwnMessage
+	}
+
+	var key skippedKey
+	copy(key.dh[:], header[2:34])
+	pn := binary.BigEndian.Uint32(header[34:38])
+	key.n = binary.BigEndian.Uint32(header[38:42])
+
+	// work on a copy, kept only when the message opens
+	st := r.ratchetState
+	st.skipped = make(map[skippedKey][]byte, len(r.skipped))
+	for k, v := range r.skipped {
+		st.skipped[k] = v
+	}
+	st.order = append([]skippedKey(nil), r.order...)
+
+	mk, ok := st.takeSkipped(key)
+	if !ok {
+		if st.dhr == nil || !bytes.Equal(key.dh[:], st.dhr.Bytes()) {
+			if err := st.skip(pn); err != nil {
+				return nil, err
+			}
+			if err := st.step(key.dh[:]); err != nil {
+				return nil, err
+			}
+		}
+
+		if key.n < st.nr {
+			return nil, ErrMessageKey
+		}
+		if err := st.skip(key.n); err != nil {
+			return nil, err
+		}
+
+		mk, st.ckr = kdfChain(st.ckr)
+		st.nr++
+	}
+
+	aead, err := chacha20poly1305.NewX(mk)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := envelope[ratchetHeaderSize:]
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	message, err := aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, ErrEnvelopeOpen
+	}
+
+	r.ratchetState = st
+	return message, nil
+}
+
+// skip keeps the keys of the receiving chain up to message until.
+func (st *ratchetState) skip(until uint32) error {
+	if st.ckr == nil || until <= st.nr {
+		return nil
+	}
+	if until > st.nr+maxSkip {
+		return ErrSkipped
+	}
+
+	var key skippedKey
+	copy(key.dh[:], st.dhr.Bytes())
+	for ; st.nr < until; st.nr++ {
+		var mk []byte
+		mk, st.ckr = kdfChain(st.ckr)
+		key.n = st.nr
+		st.addSkipped(key, mk)
+	}
+
+	return nil
+}
+
+// addSkipped keeps message key mk, dropping the oldest kept keys
+// beyond maxSkip.
+func (st *ratchetState) addSkipped(key skippedKey, mk []byte) {
+	st.skipped[key] = mk
+	st.order = append(st.order, key)
+	for len(st.order) > maxSkip {
+		delete(st.skipped, st.order[0])
+		st.order = st.order[1:]
+	}
+}
+
+// takeSkipped returns and forgets the kept message key of key.
+func (st *ratchetState) takeSkipped(key skippedKey) ([]byte, bool) {
+	mk, ok := st.skipped[key]
+	if !ok {
+		return nil, false
+	}
+
+	delete(st.skipped, key)
+	for i, k := range st.order {
+		if k == key {
+			st.order = append(st.order[:i:i], st.order[i+1:]...)
+			break
+		}
+	}
+	return mk, true
+}
+
+// step moves to the new ratchet key dh of the other party: a receiving
+// chain from it and the current key, then a sending chain from it and a
+// new key.
+func (st *ratchetState) step(dh []byte) error {
+	dhr, err := ecdh.X25519().NewPublicKey(dh)
+	if err != nil {
+		return err
+	}
+
+	st.pn, st.ns, st.nr = st.ns, 0, 0
+	st.dhr = dhr
+
+	if st.rk, st.ckr, err = st.kdfRoot(); err != nil {
+		return err
+	}
+	if st.dhs, err = ecdh.X25519().GenerateKey(rand.Reader); err != nil {
+		return err
+	}
+	st.rk, st.cks, err = st.kdfRoot()
+	return err
+}
+
+// kdfRoot mixes the ECDH secret of dhs and dhr into the root key,
+// returning the new root key and a chain key.
+func (st *ratchetState) kdfRoot() (rk, ck []byte, err error) {
+	secret, err := st.dhs.ECDH(st.dhr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := make([]byte, 64)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, st.rk, []byte(ratchetInfo)), out); err != nil {
+		return nil, nil, err
+	}
+
+	return out[:32], out[32:], nil
+}
+
+// kdfChain returns the message key of chain key ck, and the next chain key.
+func kdfChain(ck []byte) (mk, next []byte) {
+	h := hmac.New(sha256.New, ck)
+	h.Write([]byte{0x01})
+	mk = h.Sum(nil)
+
+	h = hmac.New(sha256.New, ck)
+	h.Write([]byte{0x02})
+	return mk, h.Sum(nil)
+}
+
+// ratchetJSON is the form of a Ratchet saved by MarshalBinary.
+type ratchetJSON struct {
+	Role    byte          `json:"role"`
+	DHs     []byte        `json:"dhs"`
+	DHr     []byte        `json:"dhr,omitempty"`
+	RK      []byte        `json:"rk"`
+	CKs     []byte        `json:"cks,omitempty"`
+	CKr     []byte        `json:"ckr,omitempty"`
+	Ns      uint32        `json:"ns"`
+	Nr      uint32        `json:"nr"`
+	PN      uint32        `json:"pn"`
+	Skipped []skippedJSON `json:"skipped,omitempty"`
+}
+
+type skippedJSON struct {
+	DH []byte `json:"dh"`
+	N  uint32 `json:"n"`
+	MK []byte `json:"mk"`
+}
+
+// MarshalBinary saves the state of r, to be restored with
+// UnmarshalRatchet. It holds secret keys, so it must be stored as
+// carefully as a Key, and replaced after every Seal and Open.
+func (r *Ratchet) MarshalBinary() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j := ratchetJSON{
+		Role: r.role,
+		DHs:  r.dhs.Bytes(),
+		RK:   r.rk,
+		CKs:  r.cks,
+		CKr:  r.ckr,
+		Ns:   r.ns,
+		Nr:   r.nr,
+		PN:   r.pn,
+	}
+	if r.dhr != nil {
+		j.DHr = r.dhr.Bytes()
+	}
+	for _, key := range r.order {
+		j.Skipped = append(j.Skipped, skippedJSON{append([]byte{}, key.dh[:]...), key.n, r.skipped[key]})
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalRatchet restores a Ratchet saved by MarshalBinary.
+func UnmarshalRatchet(data []byte) (*Ratchet, error) {
+	var j ratchetJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+
+	r := &Ratchet{}
+	r.role = j.Role
+	r.rk, r.cks, r.ckr = j.RK, j.CKs, j.CKr
+	r.ns, r.nr, r.pn = j.Ns, j.Nr, j.PN
+
+	var err error
+	if r.dhs, err = ecdh.X25519().NewPrivateKey(j.DHs); err != nil {
+		return nil, err
+	}
+	if j.DHr != nil {
+		if r.dhr, err = ecdh.X25519().NewPublicKey(j.DHr); err != nil {
+			return nil, err
+		}
+	}
+
+	r.skipped = make(map[skippedKey][]byte, len(j.Skipped))
+	for _, s := range j.Skipped {
+		var key skippedKey
+		copy(key.dh[:], s.DH)
+		key.n = s.N
+		r.addSkipped(key, s.MK)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,212 @@
+package address
+
+import (
+	"testing"
+)
+
+// ratchetPair returns the Ratchets of a new stream, initiator first.
+func ratchetPair(t *testing.T, keyType KeyType) (*Ratchet, *Ratchet) {
+	alice, _ := NewKeyType(keyType)
+	bob, _ := NewKeyType(keyType)
+
+	a, err := alice.Ratchet(bob.PublicKey())
+	if err != nil {
+		t.Fatal("error creating ratchet", err)
+	}
+	b, err := bob.Ratchet(alice.PublicKey())
+	if err != nil {
+		t.Fatal("error creating ratchet", err)
+	}
+
+	if a.Initiator() == b.Initiator() {
+		t.Fatal("expected one initiator")
+	}
+	if b.Initiator() {
+		return b, a
+	}
+	return a, b
+}
+
+func ratchetSend(t *testing.T, from, to *Ratchet, message string) {
+	envelope, err := from.Seal([]byte(message))
+	if err != nil {
+		t.Fatal("error sealing", err)
+	}
+
+	opened, err := to.Open(envelope)
+	if err != nil {
+		t.Fatalf("error opening %q: %v", message, err)
+	}
+	if string(opened) != message {
+		t.Errorf("expected %q, got %q", message, opened)
+	}
+}
+
+func TestRatchet(t *testing.T) {
+	for _, keyType := range []KeyType{P256, X25519} {
+		a, b := ratchetPair(t, keyType)
+
+		if _, err := b.Seal([]byte("too soon")); err != ErrRatchetWait {
+			t.Errorf("%v: expected ErrRatchetWait, got %v", keyType, err)
+		}
+
+		ratchetSend(t, a, b, "one")
+		ratchetSend(t, a, b, "two")
+		ratchetSend(t, b, a, "three")
+		ratchetSend(t, a, b, "four")
+		ratchetSend(t, b, a, "five")
+		ratchetSend(t, b, a, "six")
+	}
+}
+
+func TestRatchetOutOfOrder(t *testing.T) {
+	a, b := ratchetPair(t, P256)
+
+	first, _ := a.Seal([]byte("first"))
+	second, _ := a.Seal([]byte("second"))
+	if message, err := b.Open(second); err != nil || string(message) != "second" {
+		t.Fatalf("expected second, got %q, %v", message, err)
+	}
+	if message, err := b.Open(first); err != nil || string(message) != "first" {
+		t.Fatalf("expected first, got %q, %v", message, err)
+	}
+
+	// a message of an older chain, opened after a newer one
+	late, _ := a.Seal([]byte("late"))
+	ratchetSend(t, b, a, "reply")
+	early, _ := a.Seal([]byte("after reply"))
+	if message, err := b.Open(early); err != nil || string(message) != "after reply" {
+		t.Fatalf("expected after reply, got %q, %v", message, err)
+	}
+	if message, err := b.Open(late); err != nil || string(message) != "late" {
+		t.Fatalf("expected late, got %q, %v", message, err)
+	}
+}
+
+func TestRatchetOpenErrors(t *testing.T) {
+	a, b := ratchetPair(t, X25519)
+
+	envelope, _ := a.Seal([]byte("once"))
+	if _, err := a.Open(envelope); err != ErrOwnMessage {
+		t.Error("expected ErrOwnMessage, got", err)
+	}
+
+	tampered := append([]byte{}, envelope...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := b.Open(tampered); err != ErrEnvelopeOpen {
+		t.Error("expected ErrEnvelopeOpen, got", err)
+	}
+
+	// the failed message left the state alone
+	if _, err := b.Open(envelope); err != nil {
+		t.Fatal("error opening", err)
+	}
+
+	// message keys are deleted once used
+	if _, err := b.Open(envelope); err != ErrMessageKey {
+		t.Error("expected ErrMessageKey, got", err)
+	}
+}
+
+func TestRatchetSkippedEviction(t *testing.T) {
+	a, b := ratchetPair(t, X25519)
+
+	// batches of lost messages, more than maxSkip in all
+	var first, kept []byte
+	for batch := 0; batch < 3; batch++ {
+		var last []byte
+		for i := 0; i < maxSkip/2+10; i++ {
+			envelope, err := a.Seal([]byte("message"))
+			if err != nil {
+				t.Fatal("error sealing", err)
+			}
+			if first == nil {
+				first = envelope
+			}
+			if batch == 2 && i == 0 {
+				kept = envelope
+			}
+			last = envelope
+		}
+
+		if _, err := b.Open(last); err != nil {
+			t.Fatalf("batch %d: error opening the latest message: %v", batch, err)
+		}
+	}
+
+	if len(b.skipped) != maxSkip || len(b.order) != maxSkip {
+		t.Errorf("expected %d skipped keys, got %d", maxSkip, len(b.skipped))
+	}
+
+	// the oldest keys were dropped, recent ones kept
+	if _, err := b.Open(first); err != ErrMessageKey {
+		t.Error("expected ErrMessageKey for the oldest message, got", err)
+	}
+	if _, err := b.Open(kept); err != nil {
+		t.Error("error opening a recent skipped message", err)
+	}
+}
+
+func TestRatchetForwardSecrecy(t *testing.T) {
+	alice, _ := NewKey()
+	bob, _ := NewKey()
+	a, _ := alice.Ratchet(bob.PublicKey())
+	b, _ := bob.Ratchet(alice.PublicKey())
+	if b.Initiator() {
+		alice, bob, a, b = bob, alice, b, a
+	}
+
+	// before the first reply, both keys open the initiator's messages
+	if a.ForwardSecret() {
+		t.Error("expected no forward secrecy before the first reply")
+	}
+	first, _ := a.Seal([]byte("hello"))
+	if early, _ := bob.Ratchet(alice.PublicKey()); early != nil {
+		if _, err := early.Open(first); err != nil {
+			t.Error("expected the first message to open with the keys, got", err)
+		}
+	}
+	if _, err := b.Open(first); err != nil {
+		t.Fatal("error opening", err)
+	}
+
+	ratchetSend(t, b, a, "hi")
+	if !a.ForwardSecret() || !b.ForwardSecret() {
+		t.Error("expected forward secrecy after the first reply")
+	}
+	envelope, _ := a.Seal([]byte("secret"))
+
+	// with both keys, but not the ratchet states, the message is safe
+	fresh, _ := bob.Ratchet(alice.PublicKey())
+	if _, err := fresh.Open(envelope); err == nil {
+		t.Error("message opened with a new ratchet")
+	}
+
+	if _, err := b.Open(envelope); err != nil {
+		t.Fatal("error opening", err)
+	}
+}
+
+func TestRatchetMarshal(t *testing.T) {
+	a, b := ratchetPair(t, P256)
+
+	ratchetSend(t, a, b, "one")
+	skipped, _ := a.Seal([]byte("skipped"))
+	ratchetSend(t, a, b, "two")
+
+	for _, r := range []**Ratchet{&a, &b} {
+		data, err := (*r).MarshalBinary()
+		if err != nil {
+			t.Fatal("error marshaling", err)
+		}
+		if *r, err = UnmarshalRatchet(data); err != nil {
+			t.Fatal("error unmarshaling", err)
+		}
+	}
+
+	if message, err := b.Open(skipped); err != nil || string(message) != "skipped" {
+		t.Errorf("expected skipped, got %q, %v", message, err)
+	}
+	ratchetSend(t, b, a, "three")
+	ratchetSend(t, a, b, "four")
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// EnvelopeV1 is the version byte of the current envelope format:
+//
+//	VERSION[1 byte] || NONCE[24 bytes] || XCHACHA20-POLY1305(MESSAGE)
+//
+// The version byte is authenticated as additional data, so an envelope
+// cannot be relabeled as a different version.
+const EnvelopeV1 = 0x01
+
+// info strings used with HKDF. They keep keys derived from the ECDH secret
+// independent of each other and of the Stream address hash.
+const messageKeyInfo = "streammail/v1/message-key"
+
+var (
+	ErrEnvelopeShort   = errors.New("envelope too short")
+	ErrEnvelopeVersion = errors.New("unknown envelope version")
+	ErrEnvelopeOpen    = errors.New("envelope failed authentication")
+)
+
+// Sealer encrypts and authenticates messages for a stream.
+// Both parties of a stream derive the same Sealer.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// derive expands the ECDH secret shared with p into a key of size bytes
+// for the purpose named by info.
+func (k *Key) derive(p *Public, info string, size int) ([]byte, error) {
+	// the ECDH secret is fixed width: 32 bytes for both key types
+	ikm, err := k.secret(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return expand(ikm, info, size)
+}
+
+// expand derives a key of size bytes from the secret ikm
+// with HKDF-SHA256, for the purpose named by info.
+func expand(ikm []byte, info string, size int) ([]byte, error) {
+	key := make([]byte, size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, nil, []byte(info)), key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// MessageKey returns the symmetric key used to encrypt messages
+// between k and the owner of p.
+func (k *Key) MessageKey(p *Public) ([]byte, error) {
+	return k.derive(p, messageKeyInfo, chacha20poly1305.KeySize)
+}
+
+// Sealer returns a Sealer keyed with the MessageKey shared with p.
+func (k *Key) Sealer(p *Public) (*Sealer, error) {
+	key, err := k.MessageKey(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSealer(key)
+}
+
+// NewSealer creates a Sealer from a 32 byte symmetric key.
+func NewSealer(key []byte) (*Sealer, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sealer{aead}, nil
+}
+
+// Seal encrypts message and returns it wrapped in a version 1 envelope.
+func (s *Sealer) Seal(message []byte) ([]byte, error) {
+	header := []byte{EnvelopeV1}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	envelope := append(header, nonce...)
+	return s.aead.Seal(envelope, nonce, message, header), nil
+}
+
+// Open authenticates and decrypts an envelope created by Seal.
+func (s *Sealer) Open(envelope []byte) ([]byte, error) {
+	if len(envelope) == 0 {
+		return nil, ErrEnvelopeShort
+	}
+
+	if envelope[0] != EnvelopeV1 {
+		return nil, ErrEnvelopeVersion
+	}
+
+	header, rest := envelope[:1], envelope[1:]
+	if len(rest) < s.aead.NonceSize()+s.aead.Overhead() {
+		return nil, ErrEnvelopeShort
+	}
+
+	nonce, ciphertext := rest[:s.aead.NonceSize()], rest[s.aead.NonceSize():]
+	message, err := s.aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, ErrEnvelopeOpen
+	}
+
+	return message, nil
+}
+
+// EnvelopeVersion reports the version of an envelope without opening it,
+// so callers can recognize envelopes written by older or newer clients.
+func EnvelopeVersion(envelope []byte) (byte, error) {
+	if len(envelope) == 0 {
+		return 0, ErrEnvelopeShort
+	}
+
+	return envelope[0], nil
+}
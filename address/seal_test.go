@@ -0,0 +1,90 @@
+package address
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newPair(t *testing.T) (*Key, *Key) {
+	alice, err := NewKey()
+	if err != nil {
+		t.Fatal("error creating key", err)
+	}
+
+	bob, err := NewKey()
+	if err != nil {
+		t.Fatal("error creating key", err)
+	}
+
+	return alice, bob
+}
+
+func TestSealOpen(t *testing.T) {
+	alice, bob := newPair(t)
+
+	aliceSealer, err := alice.Sealer(&bob.Public)
+	if err != nil {
+		t.Fatal("error creating sealer", err)
+	}
+
+	bobSealer, err := bob.Sealer(&alice.Public)
+	if err != nil {
+		t.Fatal("error creating sealer", err)
+	}
+
+	message := []byte("æ a utf-8 message ʩ")
+	envelope, err := aliceSealer.Seal(message)
+	if err != nil {
+		t.Fatal("error sealing message", err)
+	}
+
+	if bytes.Contains(envelope, message) {
+		t.Error("envelope contains plaintext")
+	}
+
+	if v, _ := EnvelopeVersion(envelope); v != EnvelopeV1 {
+		t.Error("expected envelope version 1, got", v)
+	}
+
+	opened, err := bobSealer.Open(envelope)
+	if err != nil {
+		t.Fatal("error opening envelope", err)
+	}
+
+	if !bytes.Equal(opened, message) {
+		t.Errorf("expected [%s], got [%s]", message, opened)
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	alice, bob := newPair(t)
+	sealer, _ := alice.Sealer(&bob.Public)
+
+	envelope, _ := sealer.Seal([]byte("message one"))
+	envelope[len(envelope)-1] ^= 1
+	if _, err := sealer.Open(envelope); err != ErrEnvelopeOpen {
+		t.Error("expected ErrEnvelopeOpen, got", err)
+	}
+
+	envelope[0] = 0x7f
+	if _, err := sealer.Open(envelope); err != ErrEnvelopeVersion {
+		t.Error("expected ErrEnvelopeVersion, got", err)
+	}
+
+	if _, err := sealer.Open([]byte{EnvelopeV1, 1, 2, 3}); err != ErrEnvelopeShort {
+		t.Error("expected ErrEnvelopeShort, got", err)
+	}
+}
+
+func TestOpenWrongKey(t *testing.T) {
+	alice, bob := newPair(t)
+	_, eve := newPair(t)
+
+	sealer, _ := alice.Sealer(&bob.Public)
+	envelope, _ := sealer.Seal([]byte("message one"))
+
+	eveSealer, _ := eve.Sealer(&bob.Public)
+	if _, err := eveSealer.Open(envelope); err != ErrEnvelopeOpen {
+		t.Error("expected ErrEnvelopeOpen, got", err)
+	}
+}
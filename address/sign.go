@@ -0,0 +1,57 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"errors"
+)
+
+// SignatureSize is the size of a signature made by Key.Sign.
+const SignatureSize = ed25519.SignatureSize
+
+// signKeyInfo is the HKDF info of the signing key of a Key.
+const signKeyInfo = "streammail/v1/sign-key"
+
+var (
+	ErrNoSignKey = errors.New("public key has no signing key")
+	ErrSignature = errors.New("signature does not match")
+)
+
+// signingKey derives the Ed25519 signing key of private, so keys of
+// either type can sign without using the ECDH key for anything else.
+func signingKey(private *ecdh.PrivateKey) ed25519.PrivateKey {
+	// HKDF cannot fail for a single block
+	seed, _ := expand(private.Bytes(), signKeyInfo, ed25519.SeedSize)
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// Sign signs message with the Ed25519 signing key of k, so the owner of
+// k can be told apart from the other party of a stream, who shares only
+// the ECDH secret. The signing key is derived from the private key; its
+// public half is published with the public key, see Public.SignKey.
+func (k *Key) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(k.signer, message), nil
+}
+
+// SignKey returns the public half of the signing key of p, or nil
+// when p was read from a form that does not carry it.
+func (p *Public) SignKey() ed25519.PublicKey {
+	return p.sign
+}
+
+// Verify checks that sig is the signature of message by the owner of p.
+// ErrNoSignKey is returned when the signing key of p is not known.
+func (p *Public) Verify(message, sig []byte) error {
+	if p.sign == nil {
+		return ErrNoSignKey
+	}
+	if len(sig) != SignatureSize || !ed25519.Verify(p.sign, message, sig) {
+		return ErrSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package address
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	alice, _ := NewKey()
+	bob, _ := NewKey()
+	message := []byte("hello bob")
+
+	sig, err := alice.Sign(message)
+	if err != nil {
+		t.Fatal("error signing", err)
+	}
+	if len(sig) != SignatureSize {
+		t.Errorf("expected a %d byte signature, got %d", SignatureSize, len(sig))
+	}
+
+	if err := alice.PublicKey().Verify(message, sig); err != nil {
+		t.Error("error verifying", err)
+	}
+	if err := bob.PublicKey().Verify(message, sig); err != ErrSignature {
+		t.Error("expected ErrSignature for the wrong key, got", err)
+	}
+	if err := alice.PublicKey().Verify([]byte("hello mallory"), sig); err != ErrSignature {
+		t.Error("expected ErrSignature for the wrong message, got", err)
+	}
+	if err := alice.PublicKey().Verify(message, sig[1:]); err != ErrSignature {
+		t.Error("expected ErrSignature for a short signature, got", err)
+	}
+
+	x25519, _ := NewKeyType(X25519)
+	sig, err = x25519.Sign(message)
+	if err != nil {
+		t.Fatal("error signing with X25519", err)
+	}
+	if err := x25519.PublicKey().Verify(message, sig); err != nil {
+		t.Error("error verifying X25519", err)
+	}
+}
+
+func TestSignKeyPublished(t *testing.T) {
+	for _, keyType := range []KeyType{P256, X25519} {
+		key, _ := NewKeyType(keyType)
+		sig, _ := key.Sign([]byte("hello"))
+
+		text, err := ParsePublic(key.PublicKey().String())
+		if err != nil {
+			t.Fatalf("%v: error parsing text form: %v", keyType, err)
+		}
+		data, _ := key.PublicKey().MarshalPEM()
+		pem, err := ParsePublicPEM(data)
+		if err != nil {
+			t.Fatalf("%v: error parsing PEM: %v", keyType, err)
+		}
+
+		for _, p := range []*Public{text, pem} {
+			if err := p.Verify([]byte("hello"), sig); err != nil {
+				t.Errorf("%v: error verifying with a parsed key: %v", keyType, err)
+			}
+		}
+
+		// the signing key is not the ECDH key
+		if bytes.Equal(key.PublicKey().SignKey(), key.PublicKey().MarshalCompressed()) {
+			t.Errorf("%v: signing key is the ECDH key", keyType)
+		}
+
+		bare, _ := UnmarshalPublic(keyType, key.PublicKey().Marshal())
+		if err := bare.Verify([]byte("hello"), sig); err != ErrNoSignKey {
+			t.Errorf("%v: expected ErrNoSignKey, got %v", keyType, err)
+		}
+	}
+}
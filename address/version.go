@@ -0,0 +1,104 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package address
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Route prefixes of the address versions defined by this package.
+// Encoded, StreamVersion addresses start with an S or an R,
+// GroupVersion addresses with an S and TestnetVersion and
+// X25519Version addresses with an R.
+const (
+	StreamVersion  = 62
+	GroupVersion   = 63
+	TestnetVersion = 60
+	X25519Version  = 61
+)
+
+var ErrVersionExists = errors.New("address version already registered")
+
+// A Version describes what the addresses with a route prefix stand for.
+type Version struct {
+	// Prefix is the first byte of the binary address.
+	Prefix byte
+
+	// Name is a short identifier, such as "stream".
+	Name string
+
+	// Description says what the addresses are used for.
+	Description string
+}
+
+var versions = struct {
+	sync.RWMutex
+	m map[byte]Version
+}{m: map[byte]Version{
+	StreamVersion: {
+		StreamVersion, "stream",
+		"a stream between two parties, from their P-256 ECDH secret",
+	},
+	GroupVersion: {
+		GroupVersion, "group",
+		"a stream shared by a group of parties",
+	},
+	TestnetVersion: {
+		TestnetVersion, "testnet",
+		"a stream between two parties on a test deployment, derived as stream",
+	},
+	X25519Version: {
+		X25519Version, "x25519",
+		"a stream between two parties, from their X25519 ECDH secret",
+	},
+}}
+
+// RegisterVersion adds v, so Parse accepts addresses with its prefix.
+// Returns ErrVersionExists if the prefix is already registered.
+func RegisterVersion(v Version) error {
+	versions.Lock()
+	defer versions.Unlock()
+
+	if _, ok := versions.m[v.Prefix]; ok {
+		return ErrVersionExists
+	}
+
+	versions.m[v.Prefix] = v
+	return nil
+}
+
+// unregisterVersion removes the Version with route prefix prefix,
+// undoing RegisterVersion in tests.
+func unregisterVersion(prefix byte) {
+	versions.Lock()
+	defer versions.Unlock()
+
+	delete(versions.m, prefix)
+}
+
+// LookupVersion returns the Version with route prefix prefix.
+func LookupVersion(prefix byte) (Version, bool) {
+	versions.RLock()
+	defer versions.RUnlock()
+
+	v, ok := versions.m[prefix]
+	return v, ok
+}
+
+// Versions returns every registered Version, ordered by prefix.
+func Versions() []Version {
+	versions.RLock()
+	defer versions.RUnlock()
+
+	list := make([]Version, 0, len(versions.m))
+	for _, v := range versions.m {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Prefix < list[j].Prefix })
+
+	return list
+}
@@ -0,0 +1,57 @@
+package address
+
+import (
+	"testing"
+)
+
+func TestAddressVersion(t *testing.T) {
+	alice, _ := NewKey()
+	bob, _ := NewKey()
+
+	for _, v := range []struct {
+		version byte
+		first   string
+	}{{TestnetVersion, "R"}, {GroupVersion, "S"}} {
+		s, err := alice.AddressVersion(bob.PublicKey(), v.version)
+		if err != nil {
+			t.Fatal("error getting address", err)
+		}
+		if s[:1] != v.first {
+			t.Errorf("expected %s to start with %s", s, v.first)
+		}
+
+		a, err := Parse(s)
+		if err != nil {
+			t.Fatal("error parsing address", err)
+		}
+		if a.Version != v.version || a.Format().Prefix != v.version {
+			t.Errorf("expected version %d, got %+v", v.version, a)
+		}
+	}
+
+	if _, err := alice.AddressVersion(bob.PublicKey(), 1); err != ErrVersion {
+		t.Error("expected ErrVersion, got", err)
+	}
+}
+
+func TestRegisterVersion(t *testing.T) {
+	if err := RegisterVersion(Version{Prefix: StreamVersion}); err != ErrVersionExists {
+		t.Error("expected ErrVersionExists, got", err)
+	}
+
+	if err := RegisterVersion(Version{Prefix: 100, Name: "custom"}); err != nil {
+		t.Fatal("error registering version", err)
+	}
+	t.Cleanup(func() { unregisterVersion(100) })
+
+	if v, ok := LookupVersion(100); !ok || v.Name != "custom" {
+		t.Error("expected the custom version, got", v)
+	}
+
+	list := Versions()
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Prefix >= list[i].Prefix {
+			t.Error("versions out of order", list)
+		}
+	}
+}
@@ -1,23 +1,41 @@
 package main
 
 import (
+    "encoding/json"
     "flag"
     "fmt"
     "io/ioutil"
     "os"
+    "path/filepath"
+    "strconv"
     "strings"
+    "github.com/macfisherman/streammail/address"
     "github.com/macfisherman/streammail/streamclient"
 )
 
 var uri *string
-var address *string
+var addr *string
+var keyFile *string
+var peer *string
+var contact *string
+var groupFile *string
+var padding *string
+var subject *string
+var replyTo *string
 
 func main() {
     uri = flag.String("uri", "http://localhost:8080/stream/v1", "uri of the stream server")
-    address = flag.String("address", "", "address to operate against")
+    addr = flag.String("address", "", "address to operate against")
+    keyFile = flag.String("key", "", "private key file; a passphrase is read from STREAMISH_PASSPHRASE")
+    peer = flag.String("peer", "", "public key of the other party, a PEM file or in text form")
+    contact = flag.String("contact", "", "name of the other party, for restoring -key from a mnemonic")
+    groupFile = flag.String("group", "", "file holding a group, for the group commands")
+    subject = flag.String("subject", "", "subject of a structured message, for group-post")
+    replyTo = flag.String("reply-to", "", "id of the message answered by a structured message, for group-post")
+    padding = flag.String("padding", "", "padding of secure messages: pow2[:MIN], block:SIZE or random:MAX")
     flag.Parse()
 
-    stream := streamclient.NewStream(*uri, *address)
+    stream := streamclient.NewStream(*uri, *addr)
     command := strings.ToLower(flag.Arg(0))
     switch command {
         case "help":
@@ -28,8 +46,31 @@ func main() {
             read(stream, flag.Arg(1))
         case "post":
             post(stream)
+        case "fingerprint":
+            fingerprint()
+        case "mnemonic":
+            mnemonic()
+        case "restore":
+            restore()
+        case "group-create":
+            var members []string
+            if flag.NArg() > 2 {
+                members = flag.Args()[2:]
+            }
+            groupCreate(flag.Arg(1), members)
+        case "group-join":
+            groupJoin(flag.Arg(1))
+        case "group-add", "group-remove":
+            groupChange(command, flag.Arg(1))
+        case "group-list", "group-read", "group-post":
+            groupStream(command, flag.Arg(1))
+        case "attach":
+            attach(flag.Arg(1))
+        case "detach":
+            detach(flag.Arg(1), flag.Arg(2))
         default:
-            fmt.Printf("Unknown command %s: valid commands are help, list, read, post", command)
+            fmt.Printf("Unknown command %s: valid commands are help, list, read, post, fingerprint, mnemonic, restore, " +
+                "group-create, group-join, group-add, group-remove, group-list, group-read, group-post, attach, detach", command)
     }
 }
 
@@ -72,3 +113,470 @@ func post(s *streamclient.Stream) {
 
     s.PostMessage(string(msg))
 }
+
+// fingerprint shows the address and safety number shared with -peer,
+// for comparing with the other party before trusting the stream.
+func fingerprint() {
+    if *keyFile == "" || *peer == "" {
+        fmt.Println("fingerprint needs -key and -peer")
+        return
+    }
+
+    key, err := address.LoadKey(*keyFile, []byte(os.Getenv("STREAMISH_PASSPHRASE")))
+    if err != nil {
+        fmt.Println("error loading key:", err)
+        return
+    }
+
+    public, err := loadPeer(*peer)
+    if err != nil {
+        fmt.Println("error loading peer key:", err)
+        return
+    }
+
+    a, err := key.Address(public)
+    if err != nil {
+        fmt.Println("error getting address:", err)
+        return
+    }
+
+    number, err := key.Fingerprint(public)
+    if err != nil {
+        fmt.Println("error getting fingerprint:", err)
+        return
+    }
+
+    fmt.Println("address:    ", a)
+    fmt.Println("fingerprint:", number)
+    fmt.Println("Compare the fingerprint with the other party; if it differs, a key was swapped.")
+}
+
+// loadPeer reads a public key from a PEM file, or parses s as the text form.
+func loadPeer(s string) (*address.Public, error) {
+    if _, err := os.Stat(s); err == nil {
+        return address.LoadPublic(s)
+    }
+
+    return address.ParsePublic(s)
+}
+
+// mnemonic prints a new seed phrase, from which restore derives keys.
+func mnemonic() {
+    phrase, err := address.NewMnemonic(256)
+    if err != nil {
+        fmt.Println("error making mnemonic:", err)
+        return
+    }
+
+    fmt.Println(phrase)
+    fmt.Println("Write these words down; with the contact names they restore your keys.")
+}
+
+// restore reads a seed phrase from stdin and writes the key for -contact
+// to -key, encrypted with STREAMISH_PASSPHRASE when it is set.
+func restore() {
+    if *keyFile == "" || *contact == "" {
+        fmt.Println("restore needs -key and -contact")
+        return
+    }
+
+    phrase, err := ioutil.ReadAll(os.Stdin)
+    if err != nil {
+        fmt.Println("error reading stdin:", err)
+        return
+    }
+
+    keychain, err := address.RestoreKeychain(string(phrase), "")
+    if err != nil {
+        fmt.Println("error in mnemonic:", err)
+        return
+    }
+
+    key, err := keychain.ContactKey(address.P256, *contact)
+    if err != nil {
+        fmt.Println("error deriving key:", err)
+        return
+    }
+
+    if err := key.Save(*keyFile, []byte(os.Getenv("STREAMISH_PASSPHRASE"))); err != nil {
+        fmt.Println("error saving key:", err)
+        return
+    }
+
+    fmt.Println("public key:", key.PublicKey())
+}
+
+// loadKey reads -key, reporting any error.
+func loadKey() *address.Key {
+    if *keyFile == "" {
+        fmt.Println("-key is needed")
+        return nil
+    }
+
+    key, err := address.LoadKey(*keyFile, []byte(os.Getenv("STREAMISH_PASSPHRASE")))
+    if err != nil {
+        fmt.Println("error loading key:", err)
+        return nil
+    }
+
+    return key
+}
+
+// saveGroup writes g to -group. It holds the group's secret.
+func saveGroup(g *streamclient.Group) bool {
+    data, err := json.MarshalIndent(g, "", "  ")
+    if err == nil {
+        err = ioutil.WriteFile(*groupFile, data, 0600)
+    }
+    if err != nil {
+        fmt.Println("error saving group:", err)
+        return false
+    }
+
+    return true
+}
+
+func loadGroup() *streamclient.Group {
+    data, err := ioutil.ReadFile(*groupFile)
+    if err != nil {
+        fmt.Println("error reading group:", err)
+        return nil
+    }
+
+    var g streamclient.Group
+    if err := json.Unmarshal(data, &g); err != nil {
+        fmt.Println("error in group:", err)
+        return nil
+    }
+
+    return &g
+}
+
+// startGroup registers the stream of g and invites its members over
+// the streams they share with key, then saves g.
+func startGroup(key *address.Key, g *streamclient.Group) {
+    s, err := g.Stream(*uri, key)
+    if err != nil {
+        fmt.Println("error creating group stream:", err)
+        return
+    }
+
+    if err := s.Register(); err != nil {
+        fmt.Println("error registering group stream:", err)
+        return
+    }
+
+    if err := g.Distribute(*uri, key); err != nil {
+        fmt.Println("error inviting members:", err)
+        return
+    }
+
+    if saveGroup(g) {
+        fmt.Printf("group %s epoch %d: %s, %d members\n", g.Name, g.Epoch, g.Address(), len(g.Members))
+    }
+}
+
+// groupCreate creates the group name of -key and peers, which are
+// public keys as for -peer.
+func groupCreate(name string, peers []string) {
+    key := loadKey()
+    if key == nil || *groupFile == "" || name == "" || len(peers) == 0 {
+        fmt.Println("group-create needs -key, -group, a name and members")
+        return
+    }
+
+    var members []*address.Public
+    for _, p := range peers {
+        public, err := loadPeer(p)
+        if err != nil {
+            fmt.Println("error loading member key:", err)
+            return
+        }
+        members = append(members, public)
+    }
+
+    g, err := streamclient.NewGroup(name, key, members...)
+    if err != nil {
+        fmt.Println("error creating group:", err)
+        return
+    }
+
+    startGroup(key, g)
+}
+
+// groupJoin saves the group of the invite 'id' in the stream with -peer.
+func groupJoin(id string) {
+    key := loadKey()
+    if key == nil || *groupFile == "" || *peer == "" {
+        fmt.Println("group-join needs -key, -peer, -group and a message id")
+        return
+    }
+
+    public, err := loadPeer(*peer)
+    if err != nil {
+        fmt.Println("error loading peer key:", err)
+        return
+    }
+
+    s, err := streamclient.NewSecureStream(*uri, key, public)
+    if err != nil {
+        fmt.Println("error creating stream:", err)
+        return
+    }
+
+    g, err := s.ReceiveGroup(id)
+    if err != nil {
+        fmt.Println("error receiving group:", err)
+        return
+    }
+
+    if saveGroup(g) {
+        fmt.Printf("joined group %s epoch %d: %s\n", g.Name, g.Epoch, g.Address())
+    }
+}
+
+// groupChange adds or removes a member, rekeying the group.
+func groupChange(command, member string) {
+    key := loadKey()
+    if key == nil || *groupFile == "" || member == "" {
+        fmt.Println(command, "needs -key, -group and a member")
+        return
+    }
+
+    g := loadGroup()
+    if g == nil {
+        return
+    }
+
+    public, err := loadPeer(member)
+    if err != nil {
+        fmt.Println("error loading member key:", err)
+        return
+    }
+
+    var next *streamclient.Group
+    if command == "group-add" {
+        next, err = g.Add(public)
+    } else {
+        next, err = g.Remove(public)
+    }
+    if err != nil {
+        fmt.Println("error changing group:", err)
+        return
+    }
+
+    startGroup(key, next)
+}
+
+// groupStream lists, reads or posts to the group stream. Posts
+// are signed.
+func groupStream(command, id string) {
+    key := loadKey()
+    if key == nil || *groupFile == "" {
+        fmt.Println(command, "needs -key and -group")
+        return
+    }
+
+    g := loadGroup()
+    if g == nil {
+        return
+    }
+
+    s, err := g.Stream(*uri, key)
+    if err != nil {
+        fmt.Println("error creating group stream:", err)
+        return
+    }
+
+    switch command {
+        case "group-list":
+            index(s.Stream)
+        case "group-read":
+            received, err := s.Open(id)
+            if err != nil {
+                fmt.Println("error in reading message:", err)
+                return
+            }
+            from := "unsigned"
+            if received.From != nil {
+                from = received.From.String()
+            }
+            fmt.Printf("from %s:\n", from)
+            if m := received.Structured; m != nil {
+                fmt.Printf("time: %s\ntype: %s\n", m.Time, m.Type())
+                if m.Subject != "" {
+                    fmt.Println("subject:", m.Subject)
+                }
+                if m.ReplyTo != "" {
+                    fmt.Println("reply to:", m.ReplyTo)
+                }
+            }
+            fmt.Printf("%s\n", received.Message)
+        case "group-post":
+            msg, err := ioutil.ReadAll(os.Stdin)
+            if err != nil {
+                fmt.Println("error reading stdin:", err)
+                return
+            }
+            if s.Padding, err = parsePadding(*padding); err != nil {
+                fmt.Println("error in -padding:", err)
+                return
+            }
+            if *subject != "" || *replyTo != "" {
+                m := streamclient.NewMessage("", msg)
+                m.Subject, m.ReplyTo = *subject, *replyTo
+                err = s.SendMessage(m)
+            } else {
+                err = s.Send(msg)
+            }
+            if err != nil {
+                fmt.Println("error posting message:", err)
+            }
+    }
+}
+
+// secureStream returns the stream of -group, if given, or else the
+// stream of -key with -peer.
+func secureStream() *streamclient.SecureStream {
+    key := loadKey()
+    if key == nil {
+        return nil
+    }
+    pad, err := parsePadding(*padding)
+    if err != nil {
+        fmt.Println("error in -padding:", err)
+        return nil
+    }
+
+    if *groupFile != "" {
+        g := loadGroup()
+        if g == nil {
+            return nil
+        }
+        s, err := g.Stream(*uri, key)
+        if err != nil {
+            fmt.Println("error creating group stream:", err)
+            return nil
+        }
+        s.Padding = pad
+        return s
+    }
+
+    public, err := loadPeer(*peer)
+    if err != nil {
+        fmt.Println("error loading peer key:", err)
+        return nil
+    }
+
+    s, err := streamclient.NewSecureStream(*uri, key, public)
+    if err != nil {
+        fmt.Println("error creating stream:", err)
+        return nil
+    }
+
+    s.Padding = pad
+    return s
+}
+
+// parsePadding returns the address.Padding named by s, or none if s is empty.
+func parsePadding(s string) (address.Padding, error) {
+    if s == "" {
+        return nil, nil
+    }
+
+    name, arg := s, "0"
+    if i := strings.Index(s, ":"); i >= 0 {
+        name, arg = s[:i], s[i+1:]
+    }
+
+    n, err := strconv.Atoi(arg)
+    if err != nil {
+        return nil, err
+    }
+
+    switch name {
+        case "pow2":
+            return address.PowerOfTwoPadding(n), nil
+        case "block":
+            return address.BlockPadding(n), nil
+        case "random":
+            return address.RandomPadding(n), nil
+    }
+
+    return nil, fmt.Errorf("unknown padding %s", name)
+}
+
+// attach sends file in the stream of secureStream.
+func attach(file string) {
+    if file == "" {
+        fmt.Println("attach needs a file")
+        return
+    }
+
+    s := secureStream()
+    if s == nil {
+        return
+    }
+
+    f, err := os.Open(file)
+    if err != nil {
+        fmt.Println("error opening file:", err)
+        return
+    }
+    defer f.Close()
+
+    a, err := s.SendAttachment(filepath.Base(file), f)
+    if err != nil {
+        fmt.Println("error sending attachment:", err)
+        return
+    }
+
+    fmt.Printf("sent %s, %d bytes in %d chunks\n", a.Name, a.Size, len(a.Chunks))
+}
+
+// detach saves the attachment of manifest 'id' to file, or to the
+// name it was sent with in the current directory.
+func detach(id, file string) {
+    if id == "" {
+        fmt.Println("detach needs a message id")
+        return
+    }
+
+    s := secureStream()
+    if s == nil {
+        return
+    }
+
+    received, err := s.Open(id)
+    if err != nil {
+        fmt.Println("error in reading message:", err)
+        return
+    }
+    if received.Control == nil || received.Control.Attachment == nil {
+        fmt.Println("message", id, "is not an attachment")
+        return
+    }
+
+    a := received.Control.Attachment
+    if file == "" {
+        file = filepath.Base(a.Name)
+    }
+
+    f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil {
+        fmt.Println("error creating file:", err)
+        return
+    }
+
+    err = s.ReadAttachment(a, f)
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        os.Remove(file)
+        fmt.Println("error reading attachment:", err)
+        return
+    }
+
+    fmt.Printf("saved %s, %d bytes\n", file, a.Size)
+}
@@ -1,8 +1,12 @@
 #!/usr/bin/env python
 # from http://andrea.corbellini.name/2015/05/17/elliptic-curve-cryptography-a-gentle-introduction/
-# modified to add base58 of secret
+# modified to use P-256 and add base58 of secret
+#
+# usage: ecdhe.py [address/testdata/vectors.json]
 
 import collections
+import json
+import sys
 import random
 from hashlib import sha256
 from binascii import unhexlify
@@ -134,17 +138,17 @@ def b58decode_check(v):
 EllipticCurve = collections.namedtuple('EllipticCurve', 'name p a b g n h')
 
 curve = EllipticCurve(
-    'secp256k1',
+    'secp256r1',
     # Field characteristic.
-    p=0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f,
+    p=0xffffffff00000001000000000000000000000000ffffffffffffffffffffffff,
     # Curve coefficients.
-    a=0,
-    b=7,
+    a=-3,
+    b=0x5ac635d8aa3a93e7b3ebbd55769886bc651d06b0cc53b0f63bce3c3e27d2604b,
     # Base point.
-    g=(0x79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798,
-       0x483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8),
+    g=(0x6b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296,
+       0x4fe342e2fe1a7f9b8ee7eb4a7c0f9e162bce33576b315ececbb6406837bf51f5),
     # Subgroup order.
-    n=0xfffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141,
+    n=0xffffffff00000000ffffffffffffffffbce6faada7179e84f3b9cac2fc632551,
     # Subgroup cofactor.
     h=1,
 )
@@ -289,6 +293,51 @@ def make_keypair():
     return private_key, public_key
 
 
+# Stream address ##############################################################
+
+def stream_address(point, version=62, legacy=False):
+    """Returns the Stream address of the shared point.
+
+    The secret hashed is 0x04 || X || Y with X and Y 32 bytes each.
+    legacy drops leading zero bytes of X and Y, as addresses were made
+    before the width was fixed.
+    """
+    if legacy:
+        x, y = long_to_bytes(point[0]), long_to_bytes(point[1])
+    else:
+        x, y = point[0].to_bytes(32, 'big'), point[1].to_bytes(32, 'big')
+
+    # add 0x04 to indicate uncompressed key
+    key = bytes([0x04]) + x + y
+
+    # sha256 on 0x04 + x + y, then ripemd160 on that
+    sha_digest = hashlib.new('sha256', key).digest()
+    ripe_digest = hashlib.new('ripemd160', sha_digest).digest()
+
+    # add the version byte and convert into base58Check format
+    return b58encode_check(bytes([version]) + ripe_digest)
+
+
+def check_vectors(path):
+    """Checks the test vectors in path, as address/testdata/vectors.json."""
+    with open(path) as f:
+        vectors = json.load(f)
+
+    for v in vectors:
+        alice = int(v['alice_private'], 16)
+        bob = int(v['bob_private'], 16)
+        secret = scalar_mult(alice, scalar_mult(bob, curve.g))
+        assert secret == scalar_mult(bob, scalar_mult(alice, curve.g))
+
+        assert stream_address(secret) == v['address'], v['comment']
+        assert stream_address(secret, legacy=True) == v['legacy_address'], v['comment']
+        print('{}: ok'.format(v['comment']))
+
+
+if len(sys.argv) > 1:
+    check_vectors(sys.argv[1])
+    sys.exit(0)
+
 print('Curve:', curve.name)
 
 # Alice generates her own keypair.
@@ -308,29 +357,7 @@ assert s1 == s2
 
 print('Shared secret: (0x{:x}, 0x{:x})'.format(*s1))
 
-# now create base56Check form
-
-# create byte arrays out of longs
-b1 = long_to_bytes(s1[0])
-b2 = long_to_bytes(s1[1])
-
-# add 0x04 to indicate uncompressed key
-key = bytes([0x04]) + b1 + b2
-
-# sha256 on 0x04 + b1 + b2
-sha = hashlib.new('sha256')
-sha.update(key)
-sha_digest = sha.digest()
-
-# ripemd160 on previous result
-ripe = hashlib.new('ripemd160')
-ripe.update(sha_digest)
-ripe_digest = ripe.digest()
-
-# add our version byte
-# convert secret into base58Check format
-version = 62
-address = b58encode_check(bytes([version]) + ripe_digest);
+address = stream_address(s1)
 print('Stream Address is {}'.format(address))
 assert(b58decode_check(address) == True)
 
@@ -0,0 +1,69 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/macfisherman/streammail/address"
+)
+
+// authorize checks the request is allowed on address. Streams registered
+// without a verifier are open to anyone. Otherwise the request must carry
+// an X-Stream-Date header (seconds since the epoch) within SignatureWindow
+// of the server's clock, and an X-Stream-Signature made over it with the
+// key matching the verifier (see address.SignRequest).
+//
+// When the request is refused an error has already been reported and
+// false is returned. The request body is read to verify the signature
+// and replaced, so handlers can still read it.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, addr string) bool {
+	info, err := s.Store.Info(addr)
+	if err != nil {
+		report_store_error(w, 409, addr, err)
+		return false
+	}
+
+	if len(info.Verifier) == 0 {
+		return true
+	}
+
+	date := r.Header.Get("X-Stream-Date")
+	signature := r.Header.Get("X-Stream-Signature")
+	if date == "" || signature == "" {
+		report_error(w, 401, "request must be signed")
+		return false
+	}
+
+	seconds, err := strconv.ParseInt(date, 10, 64)
+	if err != nil {
+		report_error(w, 401, "invalid X-Stream-Date "+date)
+		return false
+	}
+
+	skew := time.Since(time.Unix(seconds, 0))
+	if skew > s.SignatureWindow || skew < -s.SignatureWindow {
+		report_error(w, 401, "X-Stream-Date too far from server time")
+		return false
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		report_body_error(w, err)
+		return false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if !address.VerifyRequest(info.Verifier, r.Method, r.URL.RequestURI(), date, body, signature) {
+		report_error(w, 401, "invalid signature")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrCursor = errors.New("invalid cursor")
+
+// cursor is where a page of the index left off. It is handed to clients
+// base64url encoded and they pass it back unchanged, so its contents may
+// change between versions of the server.
+type cursor struct {
+	// Seq is the last sequence number returned.
+	Seq uint64 `json:"s"`
+
+	// Bound is the far end of the range, Before going forward and
+	// After in reverse. Zero means unbounded.
+	Bound uint64 `json:"b,omitempty"`
+
+	Reverse bool `json:"r,omitempty"`
+}
+
+// nextCursor returns the cursor continuing p after last.
+func nextCursor(p Page, last uint64) string {
+	c := cursor{Seq: last, Bound: p.Before, Reverse: p.Reverse}
+	if p.Reverse {
+		c.Bound = p.After
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// parseCursor returns the Page of count messages continuing from s.
+func parseCursor(s string, count int) (Page, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Page{}, ErrCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Page{}, ErrCursor
+	}
+
+	if c.Reverse {
+		return Page{After: c.Bound, Before: c.Seq, Count: count, Reverse: true}, nil
+	}
+
+	return Page{After: c.Seq, Before: c.Bound, Count: count}, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// how often an idle event stream sends a comment, so proxies
+// and clients can tell the connection is still alive
+const keepAlive = 30 * time.Second
+
+// notifier wakes up event streams when a message is appended.
+type notifier struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]bool
+}
+
+// subscribe returns a channel that receives a value after a message is
+// appended to address. Wakeups are coalesced, so a receiver must look
+// for every message newer than the last one it has seen.
+func (n *notifier) subscribe(address string) chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.subscribers == nil {
+		n.subscribers = make(map[string]map[chan struct{}]bool)
+	}
+	if n.subscribers[address] == nil {
+		n.subscribers[address] = make(map[chan struct{}]bool)
+	}
+
+	c := make(chan struct{}, 1)
+	n.subscribers[address][c] = true
+	return c
+}
+
+func (n *notifier) unsubscribe(address string, c chan struct{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.subscribers[address], c)
+	if len(n.subscribers[address]) == 0 {
+		delete(n.subscribers, address)
+	}
+}
+
+func (n *notifier) notify(address string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for c := range n.subscribers[address] {
+		select {
+		case c <- struct{}{}:
+		default: // already has a wakeup pending
+		}
+	}
+}
+
+// writeEvent sends m as a server-sent event.
+func writeEvent(w http.ResponseWriter, m Message) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"id":   m.ID(),
+		"seq":  m.Seq,
+		"time": m.Time.Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: message\ndata: %s\n\n", m.ID(), data)
+	return err
+}
+
+// Stream API
+// GET /stream/ADDRESS/events
+//	a text/event-stream (Server-Sent Events) of the messages added to ADDRESS.
+//
+// Each event has the message-id as its id, the type "message" and a JSON
+// object { "id": ID, "seq": N, "time": TIME } as data. When the request has
+// a Last-Event-ID header, every message after that message-id is sent first,
+// so a client that reconnects does not miss messages. Without it, only
+// messages posted after the request are sent.
+//
+// On error returns either:
+//   400 if Last-Event-ID is not a message-id
+//   404 if the address does not exist
+//   409 if the server has a problem reading the Store
+//   500 if the connection cannot stream
+func (s *Server) Events(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	address := ps.ByName("address")
+	if !s.authorize(w, r, address) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		report_error(w, 500, "streaming unsupported")
+		return
+	}
+
+	// subscribe before reading the Store, so nothing posted
+	// in between is missed
+	wakeup := s.notifier.subscribe(address)
+	defer s.notifier.unsubscribe(address, wakeup)
+
+	var last uint64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		var err error
+		last, err = ParseID(id)
+		if err != nil {
+			report_error(w, 400, "invalid Last-Event-ID "+id+" :"+err.Error())
+			return
+		}
+	} else {
+		newest, err := s.Store.Range(address, Page{Count: 1, Reverse: true})
+		if err != nil {
+			report_store_error(w, 409, address, err)
+			return
+		}
+		if len(newest) > 0 {
+			last = newest[0].Seq
+		}
+	}
+
+	list, err := s.Store.Range(address, Page{After: last})
+	if err != nil {
+		report_store_error(w, 409, address, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	for {
+		for _, m := range list {
+			if err := writeEvent(w, m); err != nil {
+				return
+			}
+			last = m.Seq
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			list = nil
+		case <-wakeup:
+			list, err = s.Store.Range(address, Page{After: last})
+			if err != nil {
+				return
+			}
+		}
+	}
+}
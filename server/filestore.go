@@ -0,0 +1,527 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/macfisherman/streammail/address"
+)
+
+// FileStore keeps each stream in a directory <Root>/<address>. Each message
+// is a file named by its sequence number, zero padded so names sort in
+// sequence order, and the time it was accepted is the file's modification
+// time. This allows for simple ordered listings without any other state.
+// The StreamInfo of a stream is kept as JSON in <Root>/<address>/stream.json.
+// When the newest message is deleted its sequence number is kept in
+// <Root>/<address>/last, so it is not handed out again.
+type FileStore struct {
+	Root string
+
+	mu      sync.Mutex
+	streams map[string]*fileStream
+}
+
+// names of the files holding a stream's StreamInfo and
+// the sequence number of its newest deleted message
+const (
+	infoName = "stream.json"
+	lastName = "last"
+)
+
+// fileStream serializes changes to one stream and caches its
+// first and last sequence numbers, Usage and StreamInfo.
+type fileStream struct {
+	sync.Mutex
+	first  uint64
+	last   uint64
+	usage  Usage
+	info   StreamInfo
+	loaded bool
+}
+
+// NewFileStore creates a FileStore rooted at the directory root.
+func NewFileStore(root string) *FileStore {
+	return &FileStore{Root: root}
+}
+
+// valid returns ErrNotFound for anything that is not a Stream address,
+// so that no address, such as "..", leads outside its directory in Root.
+func valid(a string) error {
+	if address.Validate(a) != nil {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// path returns where address, or a file within it, is stored. Callers
+// check address is valid first.
+func (fs *FileStore) path(address string, file ...string) string {
+	return filepath.Join(append([]string{fs.Root, address}, file...)...)
+}
+
+// seqName returns the file name of message seq.
+func seqName(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// parseSeqName is the inverse of seqName. ok is false for
+// anything that is not a message file.
+func parseSeqName(name string) (seq uint64, ok bool) {
+	if len(name) != 20 {
+		return 0, false
+	}
+
+	seq, err := ParseID(name)
+	return seq, err == nil && seq > 0
+}
+
+func (fs *FileStore) stream(address string) *fileStream {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.streams == nil {
+		fs.streams = make(map[string]*fileStream)
+	}
+
+	st, ok := fs.streams[address]
+	if !ok {
+		st = &fileStream{}
+		fs.streams[address] = st
+	}
+
+	return st
+}
+
+// lock returns the fileStream of address, locked and loaded.
+// The caller must unlock it.
+func (fs *FileStore) lock(address string) (*fileStream, error) {
+	if err := valid(address); err != nil {
+		return nil, err
+	}
+
+	st := fs.stream(address)
+	st.Lock()
+	if err := fs.load(address, st); err != nil {
+		st.Unlock()
+		if err == ErrNotFound {
+			// don't keep state for addresses that were never registered
+			fs.mu.Lock()
+			delete(fs.streams, address)
+			fs.mu.Unlock()
+		}
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// entries returns the directory entries of address.
+func (fs *FileStore) entries(address string) ([]os.FileInfo, error) {
+	dirHandle, err := os.Open(fs.path(address))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer dirHandle.Close()
+
+	return dirHandle.Readdir(0)
+}
+
+// load finds the first and last sequence numbers of address and how
+// much it holds. Streams created before
+// sequence numbers existed named messages by their RFC3339Nano timestamp;
+// those are renumbered in time order, keeping the timestamp as the
+// modification time. The caller must hold st's lock.
+func (fs *FileStore) load(address string, st *fileStream) error {
+	if st.loaded {
+		// the directory may have been removed from outside the server
+		if _, err := os.Stat(fs.path(address)); !os.IsNotExist(err) {
+			return nil
+		}
+		st.first, st.last, st.usage, st.info, st.loaded = 0, 0, Usage{}, StreamInfo{}, false
+	}
+
+	entries, err := fs.entries(address)
+	if err != nil {
+		return err
+	}
+
+	type legacyMessage struct {
+		name string
+		time time.Time
+	}
+
+	var info StreamInfo
+	if data, err := ioutil.ReadFile(fs.path(address, infoName)); err == nil {
+		if err := json.Unmarshal(data, &info); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var first, last uint64
+	var usage Usage
+	var legacy []legacyMessage
+	for _, entry := range entries {
+		name := entry.Name()
+		if seq, ok := parseSeqName(name); ok {
+			if seq > last {
+				last = seq
+			}
+			if first == 0 || seq < first {
+				first = seq
+			}
+		} else if t, err := time.Parse(time.RFC3339Nano, name); err == nil {
+			legacy = append(legacy, legacyMessage{name, t})
+		} else {
+			continue
+		}
+
+		usage.Messages++
+		usage.Bytes += entry.Size()
+	}
+
+	if data, err := ioutil.ReadFile(fs.path(address, lastName)); err == nil {
+		if seq, err := ParseID(string(data)); err == nil && seq > last {
+			last = seq
+		}
+	}
+
+	sort.Slice(legacy, func(i, j int) bool { return legacy[i].time.Before(legacy[j].time) })
+	for _, m := range legacy {
+		last++
+		if first == 0 {
+			first = last
+		}
+		path := fs.path(address, seqName(last))
+		if err := os.Rename(fs.path(address, m.name), path); err != nil {
+			return err
+		}
+		if err := os.Chtimes(path, m.time, m.time); err != nil {
+			return err
+		}
+	}
+
+	st.first = first
+	st.last = last
+	st.usage = usage
+	st.info = info
+	st.loaded = true
+	return nil
+}
+
+// Register holds the new stream's lock until stream.json is written, so
+// other requests to this server never see the stream without its info.
+func (fs *FileStore) Register(address string, info StreamInfo) error {
+	if err := valid(address); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	// replace anything cached about address before creating it, so
+	// requests arriving after the directory exists wait for st. Should
+	// address already exist, the stream is simply reloaded when next used.
+	st := &fileStream{}
+	st.Lock()
+	defer st.Unlock()
+
+	fs.mu.Lock()
+	if fs.streams == nil {
+		fs.streams = make(map[string]*fileStream)
+	}
+	fs.streams[address] = st
+	fs.mu.Unlock()
+
+	// first go routine gets to create address, others
+	// will get OS error.
+	err = os.Mkdir(fs.path(address), 0755)
+	if os.IsExist(err) {
+		return ErrExists
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(fs.path(address, infoName), data); err != nil {
+		os.RemoveAll(fs.path(address))
+		return err
+	}
+
+	st.info = info
+	st.loaded = true
+	return nil
+}
+
+func (fs *FileStore) Info(address string) (StreamInfo, error) {
+	st, err := fs.lock(address)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	defer st.Unlock()
+
+	return st.info, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it
+// to filename, so readers never see a partial file.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".incoming-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Append first copies the message into a temporary file, so a slow client
+// does not hold up the stream, then links it under the next sequence
+// number. Linking fails rather than overwriting if another process sharing
+// Root took that number, in which case the stream is rescanned.
+func (fs *FileStore) Append(address string, r io.Reader) (Message, error) {
+	if err := valid(address); err != nil {
+		return Message{}, err
+	}
+
+	tmp, err := ioutil.TempFile(fs.path(address), ".incoming-")
+	if os.IsNotExist(err) {
+		return Message{}, ErrNotFound
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return Message{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Message{}, err
+	}
+
+	st, err := fs.lock(address)
+	if err != nil {
+		return Message{}, err
+	}
+	defer st.Unlock()
+
+	for {
+		m := Message{Seq: st.last + 1, Time: time.Now().UTC(), Size: size}
+		if err := os.Chtimes(tmp.Name(), m.Time, m.Time); err != nil {
+			return Message{}, err
+		}
+
+		err := os.Link(tmp.Name(), fs.path(address, seqName(m.Seq)))
+		if os.IsExist(err) {
+			st.loaded = false
+			if err := fs.load(address, st); err != nil {
+				return Message{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return Message{}, err
+		}
+
+		st.last = m.Seq
+		if st.first == 0 {
+			st.first = m.Seq
+		}
+		st.usage.Messages++
+		st.usage.Bytes += size
+		return m, nil
+	}
+}
+
+// Range never reads the stream's directory. Since file names are derived
+// from sequence numbers, it looks up each candidate between the cached
+// first and last sequence numbers. A page costs Count lookups plus one
+// for each sequence number it passes that was deleted, so with large
+// holes, from deletes or retention, a page may cost as many lookups as
+// the hole is wide.
+func (fs *FileStore) Range(address string, p Page) ([]Message, error) {
+	st, err := fs.lock(address)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi, ok := p.bounds(st.first, st.last)
+	st.Unlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	var list []Message
+	for n := hi - lo + 1; n > 0; n-- {
+		if p.Count > 0 && len(list) == p.Count {
+			break
+		}
+
+		seq := lo
+		if p.Reverse {
+			seq = hi
+			hi--
+		} else {
+			lo++
+		}
+
+		info, err := os.Stat(fs.path(address, seqName(seq)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, Message{seq, info.ModTime().UTC(), info.Size()})
+	}
+
+	return list, nil
+}
+
+func (fs *FileStore) Read(address string, seq uint64) (io.ReadCloser, Message, error) {
+	if seq == 0 {
+		return nil, Message{}, ErrNotFound
+	}
+
+	st, err := fs.lock(address)
+	if err != nil {
+		return nil, Message{}, err
+	}
+	st.Unlock()
+
+	msg, err := os.Open(fs.path(address, seqName(seq)))
+	if os.IsNotExist(err) {
+		return nil, Message{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Message{}, err
+	}
+
+	info, err := msg.Stat()
+	if err != nil {
+		msg.Close()
+		return nil, Message{}, err
+	}
+
+	return msg, Message{seq, info.ModTime().UTC(), info.Size()}, nil
+}
+
+// Delete keeps first pointing at the oldest remaining message, so Range
+// does not look up deleted sequence numbers again and again.
+func (fs *FileStore) Delete(address string, seq uint64) error {
+	st, err := fs.lock(address)
+	if err != nil {
+		return err
+	}
+	defer st.Unlock()
+
+	if seq == 0 || seq < st.first || seq > st.last {
+		return ErrNotFound
+	}
+
+	if seq == st.last {
+		err := writeFileAtomic(fs.path(address, lastName), []byte(seqName(seq)))
+		if err != nil {
+			return err
+		}
+	}
+
+	path := fs.path(address, seqName(seq))
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	st.usage.Messages--
+	st.usage.Bytes -= info.Size()
+
+	if seq == st.first {
+		st.first = 0
+		for next := seq + 1; next <= st.last; next++ {
+			if _, err := os.Stat(fs.path(address, seqName(next))); err == nil {
+				st.first = next
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (fs *FileStore) Usage(address string) (Usage, error) {
+	st, err := fs.lock(address)
+	if err != nil {
+		return Usage{}, err
+	}
+	defer st.Unlock()
+
+	return st.usage, nil
+}
+
+func (fs *FileStore) Remove(address string) error {
+	st, err := fs.lock(address)
+	if err != nil {
+		return err
+	}
+	defer st.Unlock()
+
+	fs.mu.Lock()
+	delete(fs.streams, address)
+	fs.mu.Unlock()
+
+	return os.RemoveAll(fs.path(address))
+}
+
+// Streams returns the names of the directories in Root
+// that are Stream addresses.
+func (fs *FileStore) Streams() ([]string, error) {
+	entries, err := ioutil.ReadDir(fs.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for _, entry := range entries {
+		if entry.IsDir() && address.Validate(entry.Name()) == nil {
+			addresses = append(addresses, entry.Name())
+		}
+	}
+
+	return addresses, nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps streams in memory. It is meant for tests
+// and short lived servers.
+type MemoryStore struct {
+	mu      sync.Mutex
+	streams map[string]*memoryStream
+}
+
+// memoryStream holds messages in Seq order.
+type memoryStream struct {
+	info     StreamInfo
+	last     uint64
+	messages []memoryMessage
+}
+
+type memoryMessage struct {
+	Message
+	data []byte
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{streams: make(map[string]*memoryStream)}
+}
+
+func (ms *MemoryStore) Register(address string, info StreamInfo) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.streams[address]; ok {
+		return ErrExists
+	}
+
+	ms.streams[address] = &memoryStream{info: info}
+	return nil
+}
+
+func (ms *MemoryStore) Info(address string) (StreamInfo, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stream, ok := ms.streams[address]
+	if !ok {
+		return StreamInfo{}, ErrNotFound
+	}
+
+	return stream.info, nil
+}
+
+func (ms *MemoryStore) Append(address string, r io.Reader) (Message, error) {
+	// read outside the lock; r may be a slow client
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Message{}, err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stream, ok := ms.streams[address]
+	if !ok {
+		return Message{}, ErrNotFound
+	}
+
+	stream.last++
+	m := Message{Seq: stream.last, Time: time.Now().UTC(), Size: int64(len(data))}
+	stream.messages = append(stream.messages, memoryMessage{m, data})
+	return m, nil
+}
+
+func (ms *MemoryStore) Range(address string, p Page) ([]Message, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stream, ok := ms.streams[address]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	messages := stream.messages
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	lo, hi, ok := p.bounds(messages[0].Seq, messages[len(messages)-1].Seq)
+	if !ok {
+		return nil, nil
+	}
+
+	// messages are in Seq order, find the slice within lo to hi
+	start := sort.Search(len(messages), func(i int) bool { return messages[i].Seq >= lo })
+	end := sort.Search(len(messages), func(i int) bool { return messages[i].Seq > hi })
+
+	var list []Message
+	for i := 0; i < end-start; i++ {
+		if p.Count > 0 && len(list) == p.Count {
+			break
+		}
+
+		if p.Reverse {
+			list = append(list, messages[end-1-i].Message)
+		} else {
+			list = append(list, messages[start+i].Message)
+		}
+	}
+
+	return list, nil
+}
+
+func (ms *MemoryStore) Read(address string, seq uint64) (io.ReadCloser, Message, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stream, ok := ms.streams[address]
+	if !ok {
+		return nil, Message{}, ErrNotFound
+	}
+
+	messages := stream.messages
+	i := sort.Search(len(messages), func(i int) bool { return messages[i].Seq >= seq })
+	if i == len(messages) || messages[i].Seq != seq {
+		return nil, Message{}, ErrNotFound
+	}
+
+	m := messages[i]
+	return ioutil.NopCloser(bytes.NewReader(m.data)), m.Message, nil
+}
+
+func (ms *MemoryStore) Delete(address string, seq uint64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stream, ok := ms.streams[address]
+	if !ok {
+		return ErrNotFound
+	}
+
+	messages := stream.messages
+	i := sort.Search(len(messages), func(i int) bool { return messages[i].Seq >= seq })
+	if i == len(messages) || messages[i].Seq != seq {
+		return ErrNotFound
+	}
+
+	stream.messages = append(messages[:i], messages[i+1:]...)
+	return nil
+}
+
+func (ms *MemoryStore) Usage(address string) (Usage, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stream, ok := ms.streams[address]
+	if !ok {
+		return Usage{}, ErrNotFound
+	}
+
+	var usage Usage
+	for _, m := range stream.messages {
+		usage.Messages++
+		usage.Bytes += m.Size
+	}
+
+	return usage, nil
+}
+
+func (ms *MemoryStore) Remove(address string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.streams[address]; !ok {
+		return ErrNotFound
+	}
+
+	delete(ms.streams, address)
+	return nil
+}
+
+func (ms *MemoryStore) Streams() ([]string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	addresses := make([]string, 0, len(ms.streams))
+	for address := range ms.streams {
+		addresses = append(addresses, address)
+	}
+
+	return addresses, nil
+}
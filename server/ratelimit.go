@@ -0,0 +1,100 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is negroni middleware that limits the requests of each
+// client IP address with a token bucket. A bucket holds up to Burst
+// tokens and gains Rate tokens a second; each request takes one, and
+// requests finding the bucket empty get a 429.
+type RateLimiter struct {
+	Rate  float64
+	Burst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing rate requests a second
+// from each IP address, in bursts of up to burst requests.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{Rate: rate, Burst: burst, buckets: make(map[string]*bucket)}
+}
+
+func (rl *RateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if wait := rl.take(ip, time.Now()); wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		report_error(w, 429, "too many requests, retry in "+strconv.Itoa(seconds)+"s")
+		return
+	}
+
+	next(w, r)
+}
+
+// take removes a token from the bucket of ip. When it is empty
+// nothing is taken and how long until a token is available is returned.
+func (rl *RateLimiter) take(ip string, now time.Time) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	b, ok := rl.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: float64(rl.Burst), last: now}
+		rl.buckets[ip] = b
+	}
+
+	b.tokens = math.Min(float64(rl.Burst), b.tokens+now.Sub(b.last).Seconds()*rl.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rl.Rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return 0
+}
+
+// sweep forgets buckets that have filled up again, as they are no
+// different from a new one. It runs at most once a minute.
+// The caller must hold rl.mu.
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.swept) < time.Minute {
+		return
+	}
+	rl.swept = now
+
+	full := time.Duration(float64(rl.Burst) / rl.Rate * float64(time.Second))
+	for ip, b := range rl.buckets {
+		if now.Sub(b.last) > full {
+			delete(rl.buckets, ip)
+		}
+	}
+}
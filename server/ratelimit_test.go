@@ -0,0 +1,35 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter(2, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if wait := rl.take("10.0.0.1", now); wait != 0 {
+			t.Fatalf("request %d: expected no wait, got %v", i, wait)
+		}
+	}
+
+	if wait := rl.take("10.0.0.1", now); wait != 500*time.Millisecond {
+		t.Error("expected to wait 500ms, got", wait)
+	}
+
+	// other addresses have their own bucket
+	if wait := rl.take("10.0.0.2", now); wait != 0 {
+		t.Error("expected no wait, got", wait)
+	}
+
+	if wait := rl.take("10.0.0.1", now.Add(500*time.Millisecond)); wait != 0 {
+		t.Error("expected a token after 500ms, got", wait)
+	}
+
+	rl.take("10.0.0.2", now.Add(time.Hour))
+	if len(rl.buckets) != 1 {
+		t.Error("expected full buckets to be swept, have", len(rl.buckets))
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrRetention = errors.New("retention limits must not be negative")
+
+// Retention limits how many messages a stream keeps. Messages beyond any
+// limit are deleted oldest first by the reaper. Zero means no limit.
+type Retention struct {
+	// MaxAge is how long a message is kept after it was posted.
+	MaxAge time.Duration
+
+	// MaxCount is the most messages kept.
+	MaxCount int
+
+	// MaxBytes is the most bytes of messages kept. The newest
+	// message is always kept, however large.
+	MaxBytes int64
+}
+
+// retentionJSON is how Retention is written in the Stream API and
+// stream.json, with MaxAge in whole seconds.
+type retentionJSON struct {
+	MaxAge   int64 `json:"max_age,omitempty"`
+	MaxCount int   `json:"max_count,omitempty"`
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+}
+
+func (r Retention) MarshalJSON() ([]byte, error) {
+	return json.Marshal(retentionJSON{int64(r.MaxAge / time.Second), r.MaxCount, r.MaxBytes})
+}
+
+func (r *Retention) UnmarshalJSON(data []byte) error {
+	var v retentionJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.MaxAge < 0 || v.MaxCount < 0 || v.MaxBytes < 0 {
+		return ErrRetention
+	}
+
+	*r = Retention{time.Duration(v.MaxAge) * time.Second, v.MaxCount, v.MaxBytes}
+	return nil
+}
+
+// within returns the tighter of each limit of r and limit.
+func (r Retention) within(limit Retention) Retention {
+	if limit.MaxAge > 0 && (r.MaxAge == 0 || limit.MaxAge < r.MaxAge) {
+		r.MaxAge = limit.MaxAge
+	}
+	if limit.MaxCount > 0 && (r.MaxCount == 0 || limit.MaxCount < r.MaxCount) {
+		r.MaxCount = limit.MaxCount
+	}
+	if limit.MaxBytes > 0 && (r.MaxBytes == 0 || limit.MaxBytes < r.MaxBytes) {
+		r.MaxBytes = limit.MaxBytes
+	}
+
+	return r
+}
+
+// expired returns the messages of list, oldest first, that r does not keep.
+func (r Retention) expired(list []Message, now time.Time) []Message {
+	if r == (Retention{}) {
+		return nil
+	}
+
+	// walk from the newest, the first message over a limit
+	// and everything older than it goes
+	var bytes int64
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		kept := len(list) - i
+		bytes += m.Size
+
+		if (r.MaxAge > 0 && now.Sub(m.Time) > r.MaxAge) ||
+			(r.MaxCount > 0 && kept > r.MaxCount) ||
+			(r.MaxBytes > 0 && bytes > r.MaxBytes && kept > 1) {
+			return list[:i+1]
+		}
+	}
+
+	return nil
+}
+
+// Reap deletes the messages of every stream that are beyond its
+// Retention or the server's.
+func (s *Server) Reap() error {
+	addresses, err := s.Store.Streams()
+	if err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		if err := s.reapStream(address, time.Now()); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) reapStream(address string, now time.Time) error {
+	info, err := s.Store.Info(address)
+	if err != nil {
+		return err
+	}
+
+	retention := info.Retention.within(s.Retention)
+	if retention == (Retention{}) {
+		return nil
+	}
+
+	list, err := s.Store.Range(address, Page{})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range retention.expired(list, now) {
+		// a client may have deleted it first
+		if err := s.Store.Delete(address, m.Seq); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunReaper calls Reap every ReapInterval until ctx is done.
+// ListenAndServe and ListenAndServeTLS run it for the Server.
+func (s *Server) RunReaper(ctx context.Context) {
+	ticker := time.NewTicker(s.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Reap(); err != nil {
+			log.Printf("reaping streams: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
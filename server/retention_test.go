@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Now()
+	list := []Message{
+		{1, now.Add(-3 * time.Hour), 10},
+		{2, now.Add(-2 * time.Hour), 10},
+		{3, now.Add(-time.Hour), 10},
+		{4, now, 100},
+	}
+
+	tests := []struct {
+		retention Retention
+		want      int
+	}{
+		{Retention{}, 0},
+		{Retention{MaxAge: 90 * time.Minute}, 2},
+		{Retention{MaxCount: 3}, 1},
+		{Retention{MaxBytes: 115}, 2},
+		{Retention{MaxBytes: 1}, 3}, // the newest is always kept
+		{Retention{MaxAge: 150 * time.Minute, MaxCount: 2}, 2},
+	}
+	for _, test := range tests {
+		if got := len(test.retention.expired(list, now)); got != test.want {
+			t.Errorf("%+v: expected %d expired, got %d", test.retention, test.want, got)
+		}
+	}
+}
+
+func TestRetentionWithin(t *testing.T) {
+	r := Retention{MaxAge: time.Hour, MaxCount: 10}.within(Retention{MaxAge: time.Minute, MaxBytes: 5})
+	if r != (Retention{time.Minute, 10, 5}) {
+		t.Error("expected the tighter limits, got", r)
+	}
+}
+
+func TestRetentionJSON(t *testing.T) {
+	var r Retention
+	if err := json.Unmarshal([]byte(`{"max_age": 60, "max_count": 2}`), &r); err != nil {
+		t.Fatal("error decoding", err)
+	}
+	if r != (Retention{MaxAge: time.Minute, MaxCount: 2}) {
+		t.Error("unexpected retention", r)
+	}
+
+	if err := json.Unmarshal([]byte(`{"max_count": -1}`), &r); err == nil {
+		t.Error("expected an error for a negative limit")
+	}
+}
+
+func TestReap(t *testing.T) {
+	store := NewMemoryStore()
+	s := NewServer(Config{Store: store, Retention: Retention{MaxBytes: 20}})
+
+	store.Register(streamAddress, StreamInfo{Retention: Retention{MaxCount: 3}})
+	for i := 0; i < 5; i++ {
+		store.Append(streamAddress, strings.NewReader("1234567"))
+	}
+
+	if err := s.Reap(); err != nil {
+		t.Fatal("error reaping", err)
+	}
+
+	// MaxCount leaves 3, MaxBytes then leaves 2
+	list, _ := store.Range(streamAddress, Page{})
+	if len(list) != 2 || list[0].Seq != 4 {
+		t.Errorf("expected seq 4 and 5, got %v", list)
+	}
+}
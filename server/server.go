@@ -0,0 +1,699 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// An embeddable Stream server.
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/macfisherman/streammail/address"
+	"github.com/urfave/negroni"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const VERSION = "v1"
+const API = "stream"
+const APP = "/"+API+"/"+VERSION
+
+// Config holds the settings of a Server. Zero values are
+// replaced with the defaults noted below by NewServer.
+type Config struct {
+	// Root is the directory streams are stored in when Store is nil.
+	// Defaults to the current working directory.
+	Root string
+
+	// Store persists streams and messages. Defaults to a FileStore
+	// rooted at Root.
+	Store Store
+
+	// Addr is the TCP address to listen on. Defaults to ":8080".
+	Addr string
+
+	// CertFile and KeyFile hold the TLS certificate and key used
+	// by ListenAndServeTLS. Default to "server.pem" and "server.key".
+	CertFile string
+	KeyFile  string
+
+	// IndexCount is the number of message-ids returned by Index when
+	// no count is given. Defaults to 100.
+	IndexCount int
+
+	// MaxIndexCount caps the count a client may ask for.
+	// Zero means no limit.
+	MaxIndexCount int
+
+	// SignatureWindow is how far the X-Stream-Date of a signed request
+	// may be from the server's clock. Defaults to 5 minutes.
+	SignatureWindow time.Duration
+
+	// Retention applies to every stream, on top of whatever limits
+	// the stream was registered with. The zero value keeps messages
+	// forever.
+	Retention Retention
+
+	// ReapInterval is how often messages beyond their retention are
+	// deleted. Defaults to 1 minute.
+	ReapInterval time.Duration
+
+	// AllowDelete lets clients delete messages and streams. Only
+	// streams registered with a verifier may be deleted from, so
+	// only their owners can do so.
+	AllowDelete bool
+
+	// MaxMessageSize is the largest message accepted, in bytes.
+	// Zero means no limit.
+	MaxMessageSize int64
+
+	// Quota is the most a single stream may hold. Unlike Retention,
+	// reaching it refuses new messages rather than deleting old ones.
+	// Zero fields mean no limit.
+	Quota Usage
+
+	// RequireVerifier makes Register refuse addresses without a
+	// verifier. Otherwise streams may be registered without one, as
+	// before verifiers existed: anyone who knows an address can then
+	// register it first, and the parties cannot register it with
+	// their verifier.
+	RequireVerifier bool
+
+	// MaxStreams caps how many streams may be registered.
+	// Zero means no limit.
+	MaxStreams int
+
+	// RateLimit is how many requests a second each client IP address
+	// may make, in bursts of up to RateBurst. Zero means no limit.
+	RateLimit float64
+	RateBurst int
+
+	// Versions are the address route prefixes accepted by Register,
+	// see address.Versions. Defaults to address.StreamVersion,
+	// address.X25519Version and address.GroupVersion.
+	Versions []byte
+}
+
+// A Server serves the Stream API. It implements http.Handler, so it
+// can be mounted in another mux or run under httptest.
+type Server struct {
+	Config
+	handler  http.Handler
+	notifier notifier
+}
+
+// NewServer creates a Server from c.
+func NewServer(c Config) *Server {
+	if c.Root == "" {
+		c.Root = "."
+	}
+	if c.Addr == "" {
+		c.Addr = ":8080"
+	}
+	if c.CertFile == "" {
+		c.CertFile = "server.pem"
+	}
+	if c.KeyFile == "" {
+		c.KeyFile = "server.key"
+	}
+	if c.IndexCount == 0 {
+		c.IndexCount = 100
+	}
+	if c.SignatureWindow == 0 {
+		c.SignatureWindow = 5 * time.Minute
+	}
+	if c.ReapInterval == 0 {
+		c.ReapInterval = time.Minute
+	}
+	if len(c.Versions) == 0 {
+		c.Versions = []byte{address.StreamVersion, address.X25519Version, address.GroupVersion}
+	}
+	if c.Store == nil {
+		c.Store = NewFileStore(c.Root)
+	}
+
+	s := &Server{Config: c}
+
+	router := httprouter.New()
+	// a cleaned or slash-fixed path can land on another route, such as
+	// "/stream/v1/..%2F.." on "/"; malformed paths are not found instead
+	router.RedirectFixedPath = false
+	router.RedirectTrailingSlash = false
+	router.GET("/", IndexPage)
+	router.POST(APP, s.Register)
+	router.POST(APP+"/:address/message", validAddress(s.PostMessage))
+	router.GET(APP+"/:address", validAddress(s.Index))
+	router.GET(APP+"/:address/index", validAddress(s.Index))
+	router.GET(APP+"/:address/message/:id", validAddress(s.GetMessage))
+	router.GET(APP+"/:address/events", validAddress(s.Events))
+	router.DELETE(APP+"/:address", validAddress(s.DeleteStream))
+	router.DELETE(APP+"/:address/message/:id", validAddress(s.DeleteMessage))
+
+	n := negroni.Classic()
+	if c.RateLimit > 0 {
+		n.Use(NewRateLimiter(c.RateLimit, c.RateBurst))
+	}
+	n.UseHandler(router)
+	s.handler = n
+
+	return s
+}
+
+// validAddress wraps the handlers of routes with an :address, answering
+// a 404 for anything that is not a Stream address, such as "..", before
+// h or the Store see it.
+func validAddress(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err := address.Validate(ps.ByName("address")); err != nil {
+			report_error(w, 404, "no such address: "+err.Error())
+			return
+		}
+
+		h(w, r, ps)
+	}
+}
+
+// ServeHTTP dispatches a request to the Stream API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the Stream API on s.Addr without TLS.
+func (s *Server) ListenAndServe() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.RunReaper(ctx)
+
+	return http.ListenAndServe(s.Addr, s)
+}
+
+// ListenAndServeTLS serves the Stream API on s.Addr using
+// s.CertFile and s.KeyFile.
+func (s *Server) ListenAndServeTLS() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.RunReaper(ctx)
+
+	return http.ListenAndServeTLS(s.Addr, s.CertFile, s.KeyFile, s)
+}
+
+// simple wrapper function to write out golang vars as json
+func WriteJSON(w http.ResponseWriter, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(b)
+	return nil
+}
+
+// report an error to client - in JSON
+func report_error(w http.ResponseWriter, code int, err string) {
+	w.WriteHeader(code)
+
+	WriteJSON(w, map[string]string{
+		"error": err,
+	})
+}
+
+// report a Store error to client - in JSON. ErrNotFound is
+// reported as a 404, anything else with code.
+func report_store_error(w http.ResponseWriter, code int, context string, err error) {
+	if err == ErrNotFound {
+		code = 404
+	}
+
+	report_error(w, code, context+": "+err.Error())
+}
+
+// report an error reading a request body to client - in JSON. Bodies cut
+// short by http.MaxBytesReader are reported as a 413, anything else as a 400.
+func report_body_error(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		report_error(w, 413, "message larger than "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+		return
+	}
+
+	report_error(w, 400, "unable to read body: "+err.Error())
+}
+
+// report a status to a client - in JSON
+func report_status(w http.ResponseWriter, code int, v interface{}) error {
+	w.WriteHeader(code)
+
+	return WriteJSON(w, v)
+}
+
+// very simple index page for now
+func IndexPage(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	fmt.Fprint(w, "Welcome!\n")
+}
+
+// Stream API
+// POST /stream/ADDRESS/message
+//	The post body contains the message.
+//	Adds a message to ADDRESS. Returns a message-id. Message ids are sequence
+//	numbers, starting at 1 and increasing by one for each message in ADDRESS.
+//
+// The message is handed to the Server's Store.
+//
+// On success an HTTP 201 with location header is returned. The JSON body holds
+// the message-id in "ok", and the sequence number and the time the message was
+// accepted (UTC, RFC3339Nano) in "seq" and "time".
+// On error, an HTTP 404 is returned when the address does not exist,
+//  a 413 when the message is larger than MaxMessageSize or what is left of
+//  the Quota, a 507 when the stream is at its Quota
+//  or a 409 when the message could not be stored
+func (s *Server) PostMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	address := ps.ByName("address")
+	if s.MaxMessageSize > 0 {
+		if r.ContentLength > s.MaxMessageSize {
+			report_error(w, 413, "message larger than "+strconv.FormatInt(s.MaxMessageSize, 10)+" bytes")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.MaxMessageSize)
+	}
+
+	if !s.authorize(w, r, address) {
+		return
+	}
+
+	if !s.withinQuota(w, r, address) {
+		return
+	}
+
+	m, err := s.Store.Append(address, r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		report_body_error(w, err)
+		return
+	}
+	if err != nil {
+		report_store_error(w, 409, "in storing message for "+address, err)
+		return
+	}
+	s.notifier.notify(address)
+
+	w.Header().Set("Location", "/stream/"+address+"/message/"+m.ID())
+	report_status(w, 201, map[string]interface{}{
+		"ok":   m.ID(),
+		"seq":  m.Seq,
+		"time": m.Time.Format(time.RFC3339Nano),
+	})
+}
+
+// withinQuota checks another message fits in the Quota of address,
+// reporting an error when it does not. The body of r is limited to
+// the bytes left. Concurrent posts may together go past the Quota.
+func (s *Server) withinQuota(w http.ResponseWriter, r *http.Request, address string) bool {
+	if s.Quota == (Usage{}) {
+		return true
+	}
+
+	usage, err := s.Store.Usage(address)
+	if err != nil {
+		report_store_error(w, 409, address, err)
+		return false
+	}
+
+	left := s.Quota.Bytes - usage.Bytes
+	if (s.Quota.Messages > 0 && usage.Messages >= s.Quota.Messages) ||
+		(s.Quota.Bytes > 0 && (left <= 0 || r.ContentLength > left)) {
+		report_error(w, 507, "stream quota exceeded")
+		return false
+	}
+
+	if s.Quota.Bytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, left)
+	}
+
+	return true
+}
+
+// Stream API
+// GET /stream/ADDRESS/message/ID
+//	gets a single message
+//
+// On success, returns 200 plus a data blob in the body. The sequence number
+// and time of the message are returned in the X-Stream-Seq and X-Stream-Time
+// headers.
+// On error, returns either a 404 when the message does no exist
+//  or a 409 when unable to return the message due to a system error
+func (s *Server) GetMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !s.authorize(w, r, ps.ByName("address")) {
+		return
+	}
+
+	id := ps.ByName("address") + "/" + ps.ByName("id")
+	seq, err := ParseID(ps.ByName("id"))
+	if err != nil {
+		report_error(w, 404, id+": "+ErrNotFound.Error())
+		return
+	}
+
+	msg, m, err := s.Store.Read(ps.ByName("address"), seq)
+	if err != nil {
+		report_store_error(w, 409, id, err)
+		return
+	}
+	defer msg.Close()
+
+	w.Header().Set("X-Stream-Seq", m.ID())
+	w.Header().Set("X-Stream-Time", m.Time.Format(time.RFC3339Nano))
+
+	// msg is an opaque blob: clients structure their messages inside
+	// the encryption, see streamclient.Message
+	if _, err := io.Copy(w, msg); err != nil {
+		report_error(w, 409, err.Error())
+		return
+	}
+}
+
+// Stream API
+// DELETE /stream/ADDRESS/message/ID
+//	deletes a single message. Its message-id is not used again.
+//
+// Only allowed when the server has AllowDelete set, for streams registered
+// with a verifier, and the request must be signed.
+// On success, returns 200.
+// On error, returns either
+//   401 if the request is not signed correctly
+//   403 if deleting is not allowed
+//   404 if the message does not exist
+//   409 if the Store is unable to delete it
+func (s *Server) DeleteMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	address := ps.ByName("address")
+	if !s.deletable(w, r, address) {
+		return
+	}
+
+	id := address + "/" + ps.ByName("id")
+	seq, err := ParseID(ps.ByName("id"))
+	if err != nil {
+		report_error(w, 404, id+": "+ErrNotFound.Error())
+		return
+	}
+
+	if err := s.Store.Delete(address, seq); err != nil {
+		report_store_error(w, 409, id, err)
+		return
+	}
+
+	report_status(w, 200, map[string]string{"ok": "message deleted"})
+}
+
+// Stream API
+// DELETE /stream/ADDRESS
+//	deletes ADDRESS and all of its messages. ADDRESS may be registered again.
+//
+// Allowed under the same conditions as DELETE /stream/ADDRESS/message/ID.
+// Clients following the events of ADDRESS are disconnected.
+// On success, returns 200.
+// On error, returns either
+//   401 if the request is not signed correctly
+//   403 if deleting is not allowed
+//   404 if the address does not exist
+//   409 if the Store is unable to delete it
+func (s *Server) DeleteStream(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	address := ps.ByName("address")
+	if !s.deletable(w, r, address) {
+		return
+	}
+
+	if err := s.Store.Remove(address); err != nil {
+		report_store_error(w, 409, address, err)
+		return
+	}
+	s.notifier.notify(address)
+
+	report_status(w, 200, map[string]string{"ok": "address deleted"})
+}
+
+// deletable checks a delete request on address is allowed,
+// reporting an error when it is not.
+func (s *Server) deletable(w http.ResponseWriter, r *http.Request, address string) bool {
+	if !s.AllowDelete {
+		report_error(w, 403, "deleting is not allowed on this server")
+		return false
+	}
+
+	info, err := s.Store.Info(address)
+	if err != nil {
+		report_store_error(w, 409, address, err)
+		return false
+	}
+	if len(info.Verifier) == 0 {
+		report_error(w, 403, "only streams with a verifier can be deleted from")
+		return false
+	}
+
+	return s.authorize(w, r, address)
+}
+
+// Stream API
+// GET /stream/ADDRESS
+// GET /stream/ADDRESS?count=N
+// GET /stream/ADDRESS?from=ID
+// GET /stream/ADDRESS?from=ID&count=N
+// GET /stream/ADDRESS?after=ID&before=ID&order=desc&count=N
+// GET /stream/ADDRESS?cursor=CURSOR&count=N
+//
+//	get message-ids, as a JSON array.
+//
+// The first form will return up to 100 message-ids starting with the first message.
+// The second form will return up to N message-ids, starting with the first message.
+// The third form will return up to 100 message-ids starting with message-id ID.
+// The forth form will return up to N message-ids starting from message-id ID.
+// The fifth form returns message-ids above after and below before, either of
+// which may be left out. With order=desc the newest message-ids come first.
+// In all of these, ID need not exist.
+//
+// When more message-ids remain, the X-Stream-Cursor header holds an opaque
+// CURSOR. The last form continues the listing where the page with that
+// cursor ended, in the same order and within the same bounds.
+//
+// Unless order=desc, message-ids are returned in increasing sequence order.
+//
+// The On success, returns a JSON array (up to N or 100 elements) of message-ids
+// On error, returns either
+//   404 if the address does not exist or
+//   409 if the server has a problem reading the Store
+//   400 if the count N or an ID is not a number, or the cursor is invalid
+//   409 if the server cannot encode the data as JSON
+func (s *Server) Index(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	address := ps.ByName("address")
+	vars := r.URL.Query()
+	if !s.authorize(w, r, address) {
+		return
+	}
+
+	// setup a count - default to s.IndexCount
+	count := s.IndexCount
+	if n := vars.Get("count"); n != "" {
+		var err error
+		count, err = strconv.Atoi(n)
+		if err != nil || count < 0 {
+			report_error(w, 400, "invalid number "+n)
+			return
+		}
+	}
+	if s.MaxIndexCount > 0 && count > s.MaxIndexCount {
+		count = s.MaxIndexCount
+	}
+
+	page, err := indexPage(vars, count)
+	if err != nil {
+		report_error(w, 400, err.Error())
+		return
+	}
+
+	// ask for one more than wanted, to know if there is a next page
+	var list []Message
+	if count > 0 {
+		page.Count = count + 1
+		list, err = s.Store.Range(address, page)
+		if err != nil {
+			report_store_error(w, 409, address, err)
+			return
+		}
+	}
+
+	if len(list) > count {
+		list = list[:count]
+		w.Header().Set("X-Stream-Cursor", nextCursor(page, list[count-1].Seq))
+	}
+
+	names := make([]string, len(list))
+	for i, m := range list {
+		names[i] = m.ID()
+	}
+
+	encoder := json.NewEncoder(w)
+	err = encoder.Encode(names)
+	if err != nil {
+		report_error(w, 409, err.Error())
+		return
+	}
+}
+
+// indexPage turns the query of an Index request into a Page.
+func indexPage(vars url.Values, count int) (Page, error) {
+	if c := vars.Get("cursor"); c != "" {
+		return parseCursor(c, count)
+	}
+
+	var page Page
+	for _, bound := range []struct {
+		name string
+		seq  *uint64
+	}{{"from", &page.After}, {"after", &page.After}, {"before", &page.Before}} {
+		id := vars.Get(bound.name)
+		if id == "" {
+			continue
+		}
+
+		seq, err := ParseID(id)
+		if err != nil {
+			return page, errors.New("invalid message-id " + id)
+		}
+
+		// from includes ID, after does not
+		if bound.name == "from" && seq > 0 {
+			seq--
+		}
+		*bound.seq = seq
+	}
+
+	switch vars.Get("order") {
+	case "", "asc":
+	case "desc":
+		page.Reverse = true
+	default:
+		return page, errors.New("order must be asc or desc")
+	}
+
+	return page, nil
+}
+
+// accepts tells whether Register takes addresses with route prefix version.
+func (s *Server) accepts(version byte) bool {
+	for _, v := range s.Versions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stream API
+// POST /stream
+// with JSON:	{ "address": ADDRESS }
+// or JSON:	{ "address": ADDRESS, "verifier": VERIFIER }
+//	Register address with server
+//	ADDRESS MUST conform to base58Check
+//	VERIFIER is an ed25519 public key in unpadded base64url. When given, every
+//	later request for ADDRESS must be signed with the matching private key
+//	(see authorize). Registering without one is the legacy form: anyone
+//	can then use ADDRESS, and whoever registers it first keeps it.
+//	Servers with RequireVerifier refuse it.
+//	An optional "retention" object, { "max_age": SECONDS, "max_count": N,
+//	"max_bytes": N }, limits the messages kept, oldest being deleted first.
+//	The server's own Retention applies as well.
+//
+// On success returns an HTTP 201 with a Location header
+// On error returns either:
+//  400 - unable to parse input JSON
+//  400 - missing JSON field
+//  400 - invalid address
+//  400 - invalid Stream address (must start with an S or R)
+//  400 - address version not in Versions
+//  400 - invalid verifier
+//  400 - missing verifier, with RequireVerifier
+//  400 - invalid retention
+//  507 - the server already holds MaxStreams streams
+//  409 - unable to create the Stream address in the Store
+//
+func (s *Server) Register(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var fields map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		r.Body.Close()
+		report_error(w, 400, "unable to parse JSON: "+err.Error())
+		return
+	}
+
+	addr, ok := fields["address"].(string)
+	if !ok {
+		report_error(w, 400, "missing needed field, address")
+		return
+	}
+
+	log.Printf("address is: %v", addr)
+	a, err := address.Parse(addr)
+	if err == address.ErrVersion {
+		report_error(w, 400, err.Error())
+		return
+	} else if err != nil {
+		report_error(w, 400, "address format is invalid")
+		return
+	}
+	if !s.accepts(a.Version) {
+		report_error(w, 400, "address version "+a.Format().Name+" not accepted by this server")
+		return
+	}
+
+	var info StreamInfo
+	if v, ok := fields["verifier"].(string); ok {
+		verifier, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || len(verifier) != ed25519.PublicKeySize {
+			report_error(w, 400, "invalid verifier")
+			return
+		}
+		info.Verifier = verifier
+	} else if s.RequireVerifier {
+		report_error(w, 400, "missing needed field, verifier")
+		return
+	}
+
+	if v, ok := fields["retention"]; ok {
+		// decode again, now into the Retention it should be
+		data, _ := json.Marshal(v)
+		if err := json.Unmarshal(data, &info.Retention); err != nil {
+			report_error(w, 400, "invalid retention: "+err.Error())
+			return
+		}
+	}
+
+	if s.MaxStreams > 0 {
+		addresses, err := s.Store.Streams()
+		if err != nil {
+			report_error(w, 409, "unable to count streams: "+err.Error())
+			return
+		}
+		if len(addresses) >= s.MaxStreams {
+			report_error(w, 507, "server cannot hold more streams")
+			return
+		}
+	}
+
+	// first go routine gets to create address, others
+	// will get ErrExists.
+	if err := s.Store.Register(addr, info); err != nil {
+		report_error(w, 409, "unable to create address:"+err.Error())
+	} else {
+		w.Header().Set("Location", "/stream/"+addr)
+		report_status(w, 201, map[string]string{"ok": "address registered"})
+	}
+}
@@ -0,0 +1,559 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+//	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/macfisherman/streammail/address"
+)
+
+const streamAddress = "SFwExaKH1iu2iK9gW3W2dnRQZewcmGkv6q"
+
+// baseURI and root are set up by TestMain
+var baseURI string
+var root string
+
+func TestMain(m *testing.M) {
+	var err error
+	root, err = ioutil.TempDir("", "stream")
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(NewServer(Config{Root: root}))
+	baseURI = ts.URL + APP
+
+	code := m.Run()
+	ts.Close()
+	os.RemoveAll(root)
+	os.Exit(code)
+}
+
+func removeStream(address string) {
+	os.RemoveAll(filepath.Join(root, address))
+}
+
+type addressCriteria struct {
+	Address string
+	Field   string
+	Want    string
+}
+
+func getIndexFrom(t *testing.T, address string, from string, count int) *http.Response {
+	uri := baseURI + "/" + address + "/index?from=" + from
+	if count > 0 {
+		uri = uri + "&count=" + strconv.Itoa(count)
+	}
+	return (get(t, uri))
+}
+
+func getIndex(t *testing.T, address string) *http.Response {
+	return (get(t, baseURI+"/"+address))
+}
+
+func postMessage(t *testing.T, address string, message string) *http.Response {
+	return postString(t, message, baseURI+"/"+address+"/message")
+}
+
+func getMessage(t *testing.T, address string, id string) *http.Response {
+	return get(t, baseURI+"/"+address+"/message/"+id)
+}
+
+func newStream(t *testing.T, address string) *http.Response {
+	return postMap(t, map[string]string{"address": address}, baseURI)
+}
+
+func get(t *testing.T, uri string) *http.Response {
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		t.Fatal("error creating request object:", err)
+	}
+
+	req.Header.Set("Content-Type", "application/vnd.api+json") // vnd.api should be something stream specific?
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal("error with GET request", err)
+	}
+
+	return resp
+}
+
+func postString(t *testing.T, data string, uri string) *http.Response {
+	buffer := bytes.NewBufferString(data)
+	resp, err := http.Post(uri, "application/json", buffer)
+	if err != nil {
+		t.Fatal("fatal error in posting:", err)
+	}
+
+	return resp
+}
+
+func postMap(t *testing.T, d map[string]string, uri string) *http.Response {
+	buffer := new(bytes.Buffer)
+	json.NewEncoder(buffer).Encode(d)
+	resp, err := http.Post(uri, "application/json", buffer)
+	if err != nil {
+		t.Fatal("fatal error in posting:", err)
+	}
+
+	return resp
+}
+
+func decodeResponse(t *testing.T, r *http.Response) map[string]interface{} {
+	var v map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		t.Fatal("fatal error in decoding response:", err)
+	}
+
+	return v
+}
+
+func decodeResponseArray(t *testing.T, r *http.Response) []interface{} {
+	var v []interface{}
+
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		t.Fatal("fatal error in decoding response:", err)
+	}
+
+	return v
+}
+
+func TestStreamAddresses(t *testing.T) {
+	criteria := []addressCriteria{
+		{"SFwExaKH1iu2iK9gW3W2dnRQZewcmGkv6q", "ok", "address registered"},
+		{"1FwExaKH1iu2iK9gW3W2dnRQZewcmGkv6q", "error", "address not a STREAM address"},
+		{"SFwExaKH1iuZiK9gW3W2dnRQZewcmGkv6q", "error", "address format is invalid"}}
+
+	removeStream("SFwExaKH1iu2iK9gW3W2dnRQZewcmGkv6q")
+	for _, c := range criteria {
+		resp := newStream(t, c.Address)
+		v := decodeResponse(t, resp)
+
+		if v[c.Field] != c.Want {
+			t.Errorf("Expected [%s], got [%s]", c.Want, v[c.Field])
+		}
+	}
+}
+
+func TestMissingFieldAddress(t *testing.T) {
+	resp := postMap(t, map[string]string{"addressy": streamAddress}, baseURI)
+	v := decodeResponse(t, resp)
+	if v["error"] != "missing needed field, address" {
+		t.Error("Expected [missing needed field, address], got", v["error"])
+	}
+}
+
+func TestStreamBogusJSON(t *testing.T) {
+	resp := postString(t, "\"address\": \""+streamAddress+"\"", baseURI)
+	v := decodeResponse(t, resp)
+	if !strings.Contains(v["error"].(string), "unable to parse JSON") {
+		t.Error("Expected [unable to parse JSON...], got", v["error"])
+	}
+}
+
+func TestStreamExisting(t *testing.T) {
+	removeStream(streamAddress)
+	_ = newStream(t, streamAddress)
+	// post again
+	resp := newStream(t, streamAddress)
+	v := decodeResponse(t, resp)
+	if !strings.Contains(v["error"].(string), "unable to create address") {
+		t.Error("Expected [unable to create address...], got", v["error"])
+	}
+}
+
+func TestStreamMessage(t *testing.T) {
+	removeStream(streamAddress)
+	_ = newStream(t, streamAddress)
+
+	// a message
+	resp := postMessage(t, streamAddress, "æ a utf-8 message ʩ")
+	v := decodeResponse(t, resp)
+	if v["ok"] != "1" || v["seq"] != 1.0 {
+		t.Errorf("Expected message-id 1, got %v", v)
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, v["time"].(string)); err != nil {
+		t.Error("Expected a valid time-stamp, got", v["time"])
+	}
+
+	// see if there is a location header
+	if !strings.Contains(resp.Header.Get("Location"),
+		"/stream/SFwExaKH1iu2iK9gW3W2dnRQZewcmGkv6q/message/1") {
+		t.Error("Location header not set")
+	}
+}
+
+func TestStreamIndex(t *testing.T) {
+	removeStream(streamAddress)
+	_ = newStream(t, streamAddress)
+
+	// a bunch of messages
+	for i := 0; i < 10; i++ {
+		_ = postMessage(t, streamAddress, "message "+strconv.Itoa(i))
+	}
+	resp := getIndex(t, streamAddress)
+	v := decodeResponseArray(t, resp)
+	l := len(v)
+	if l != 10 {
+		t.Error("Expected 10 items, got", l)
+	}
+}
+
+func TestStreamIndexFrom(t *testing.T) {
+	removeStream(streamAddress)
+	_ = newStream(t, streamAddress)
+
+	// a bunch of messages
+	for i := 0; i < 120; i++ {
+		_ = postMessage(t, streamAddress, "message "+strconv.Itoa(i))
+	}
+	resp := getIndex(t, streamAddress)
+	v := decodeResponseArray(t, resp)
+	l := len(v)
+	if l != 100 {
+		t.Error("Expected 100 items, got", l)
+	}
+
+	from := v[99].(string)
+	resp = getIndexFrom(t, streamAddress, from, 4)
+	v = decodeResponseArray(t, resp)
+	l = len(v)
+	if l != 4 {
+		t.Error("Expected 4 items, got", l)
+	}
+
+	from = v[3].(string)
+	resp = getIndexFrom(t, streamAddress, from, 0)
+	v = decodeResponseArray(t, resp)
+	l = len(v)
+	if l != 18 {
+		t.Error("Expected 18 items, got", l)
+	}
+}
+
+func TestStreamGetMessage(t *testing.T) {
+	removeStream(streamAddress)
+
+	_ = newStream(t, streamAddress)
+	_ = postMessage(t, streamAddress, "message one")
+
+	// get first message
+	resp := getIndex(t, streamAddress)
+	v := decodeResponseArray(t, resp)
+	resp = getMessage(t, streamAddress, v[0].(string))
+	
+	//getMessage just returns messsage as a blob
+	defer resp.Body.Close()
+	message, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal("error reading body", err)
+	}
+	
+	if string(message) != "message one" {
+		t.Error("expected [message one], got", message)
+	}
+}
+func TestStreamSequence(t *testing.T) {
+	removeStream(streamAddress)
+	_ = newStream(t, streamAddress)
+
+	for i := 0; i < 5; i++ {
+		_ = postMessage(t, streamAddress, "message "+strconv.Itoa(i))
+	}
+
+	resp := getIndex(t, streamAddress)
+	v := decodeResponseArray(t, resp)
+	for i, id := range v {
+		if id != strconv.Itoa(i+1) {
+			t.Errorf("Expected message-id %d, got %v", i+1, id)
+		}
+	}
+
+	// from need not be an existing message-id
+	resp = getIndexFrom(t, streamAddress, "4", 0)
+	v = decodeResponseArray(t, resp)
+	if len(v) != 2 || v[0] != "4" {
+		t.Error("Expected [4 5], got", v)
+	}
+
+	resp = getMessage(t, streamAddress, "3")
+	if resp.Header.Get("X-Stream-Seq") != "3" {
+		t.Error("Expected X-Stream-Seq 3, got", resp.Header.Get("X-Stream-Seq"))
+	}
+	if _, err := time.Parse(time.RFC3339Nano, resp.Header.Get("X-Stream-Time")); err != nil {
+		t.Error("Expected a valid X-Stream-Time, got", resp.Header.Get("X-Stream-Time"))
+	}
+}
+
+func TestStreamVerifier(t *testing.T) {
+	removeStream(streamAddress)
+
+	resp := postMap(t, map[string]string{"address": streamAddress, "verifier": "short"}, baseURI)
+	v := decodeResponse(t, resp)
+	if v["error"] != "invalid verifier" {
+		t.Error("Expected [invalid verifier], got", v["error"])
+	}
+
+	signer := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	verifier := base64.RawURLEncoding.EncodeToString(signer.Public().(ed25519.PublicKey))
+	resp = postMap(t, map[string]string{"address": streamAddress, "verifier": verifier}, baseURI)
+	if resp.StatusCode != 201 {
+		t.Fatal("Expected 201, got", resp.StatusCode)
+	}
+
+	resp = postMessage(t, streamAddress, "unsigned")
+	if resp.StatusCode != 401 {
+		t.Error("Expected 401, got", resp.StatusCode)
+	}
+
+	uri := baseURI + "/" + streamAddress + "/message"
+	req, _ := http.NewRequest("POST", uri, strings.NewReader("signed"))
+	date := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-Stream-Date", date)
+	req.Header.Set("X-Stream-Signature", address.SignRequest(signer, "POST", req.URL.RequestURI(), date, []byte("signed")))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("error posting", err)
+	}
+	if resp.StatusCode != 201 {
+		t.Error("Expected 201, got", resp.StatusCode, decodeResponse(t, resp))
+	}
+
+	// an old date is refused even with a good signature
+	date = strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	req, _ = http.NewRequest("POST", uri, strings.NewReader("signed"))
+	req.Header.Set("X-Stream-Date", date)
+	req.Header.Set("X-Stream-Signature", address.SignRequest(signer, "POST", req.URL.RequestURI(), date, []byte("signed")))
+	resp, _ = http.DefaultClient.Do(req)
+	if resp.StatusCode != 401 {
+		t.Error("Expected 401, got", resp.StatusCode)
+	}
+}
+
+func TestStreamIndexCursor(t *testing.T) {
+	removeStream(streamAddress)
+	_ = newStream(t, streamAddress)
+
+	for i := 0; i < 7; i++ {
+		_ = postMessage(t, streamAddress, "message "+strconv.Itoa(i))
+	}
+
+	// walk the stream newest first, three at a time
+	uri := baseURI + "/" + streamAddress + "/index?order=desc&before=7&count=3"
+	ids := []interface{}{}
+	for pages := 0; uri != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+
+		resp := get(t, uri)
+		ids = append(ids, decodeResponseArray(t, resp)...)
+
+		uri = ""
+		if next := resp.Header.Get("X-Stream-Cursor"); next != "" {
+			uri = baseURI + "/" + streamAddress + "/index?count=3&cursor=" + next
+		}
+	}
+
+	want := []interface{}{"6", "5", "4", "3", "2", "1"}
+	if len(ids) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, ids)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, ids)
+		}
+	}
+
+	resp := get(t, baseURI+"/"+streamAddress+"/index?after=2&before=5")
+	v := decodeResponseArray(t, resp)
+	if len(v) != 2 || v[0] != "3" || v[1] != "4" {
+		t.Error("Expected [3 4], got", v)
+	}
+	if resp.Header.Get("X-Stream-Cursor") != "" {
+		t.Error("Expected no cursor on the last page")
+	}
+
+	resp = get(t, baseURI+"/"+streamAddress+"/index?cursor=bogus")
+	if resp.StatusCode != 400 {
+		t.Error("Expected 400 for a bogus cursor, got", resp.StatusCode)
+	}
+}
+
+func TestStreamDeleteNotAllowed(t *testing.T) {
+	removeStream(streamAddress)
+	_ = newStream(t, streamAddress)
+	_ = postMessage(t, streamAddress, "message one")
+
+	req, _ := http.NewRequest("DELETE", baseURI+"/"+streamAddress+"/message/1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("error deleting", err)
+	}
+	if resp.StatusCode != 403 {
+		t.Error("Expected 403, got", resp.StatusCode)
+	}
+}
+
+func TestStreamRegisterLegacy(t *testing.T) {
+	signer := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	verifier := base64.RawURLEncoding.EncodeToString(signer.Public().(ed25519.PublicKey))
+
+	// without a verifier anyone may register an address first,
+	// and the parties cannot register it with theirs
+	ts := httptest.NewServer(NewServer(Config{Store: NewMemoryStore()}))
+	defer ts.Close()
+
+	resp := postMap(t, map[string]string{"address": streamAddress}, ts.URL+APP)
+	if resp.StatusCode != 201 {
+		t.Fatal("Expected 201, got", resp.StatusCode)
+	}
+	resp = postMap(t, map[string]string{"address": streamAddress, "verifier": verifier}, ts.URL+APP)
+	if resp.StatusCode != 409 {
+		t.Error("Expected 409, got", resp.StatusCode)
+	}
+
+	// RequireVerifier refuses that
+	strict := httptest.NewServer(NewServer(Config{Store: NewMemoryStore(), RequireVerifier: true}))
+	defer strict.Close()
+
+	resp = postMap(t, map[string]string{"address": streamAddress}, strict.URL+APP)
+	if v := decodeResponse(t, resp); resp.StatusCode != 400 || v["error"] != "missing needed field, verifier" {
+		t.Error("Expected 400 [missing needed field, verifier], got", resp.StatusCode, v)
+	}
+	resp = postMap(t, map[string]string{"address": streamAddress, "verifier": verifier}, strict.URL+APP)
+	if resp.StatusCode != 201 {
+		t.Error("Expected 201, got", resp.StatusCode)
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	ts := httptest.NewServer(NewServer(Config{
+		Store:          NewMemoryStore(),
+		MaxMessageSize: 10,
+		Quota:          Usage{Messages: 3, Bytes: 15},
+		MaxStreams:     1,
+	}))
+	defer ts.Close()
+	uri := ts.URL + APP
+
+	resp := postMap(t, map[string]string{"address": streamAddress}, uri)
+	if resp.StatusCode != 201 {
+		t.Fatal("Expected 201, got", resp.StatusCode)
+	}
+
+	key, _ := address.NewKey()
+	other, _ := key.Address(key.PublicKey())
+	resp = postMap(t, map[string]string{"address": other}, uri)
+	if resp.StatusCode != 507 {
+		t.Error("Expected 507 for too many streams, got", resp.StatusCode)
+	}
+
+	uri = uri + "/" + streamAddress + "/message"
+	resp = postString(t, "this message is too long", uri)
+	if resp.StatusCode != 413 {
+		t.Error("Expected 413, got", resp.StatusCode)
+	}
+
+	// 8 bytes left of the quota after this
+	resp = postString(t, "seven..", uri)
+	if resp.StatusCode != 201 {
+		t.Fatal("Expected 201, got", resp.StatusCode)
+	}
+
+	resp = postString(t, "nine.....", uri)
+	if resp.StatusCode != 507 {
+		t.Error("Expected 507 for the byte quota, got", resp.StatusCode)
+	}
+
+	_ = postString(t, "1", uri)
+	_ = postString(t, "2", uri)
+	resp = postString(t, "3", uri)
+	if resp.StatusCode != 507 {
+		t.Error("Expected 507 for the message quota, got", resp.StatusCode)
+	}
+	if v := decodeResponse(t, resp); v["error"] != "stream quota exceeded" {
+		t.Error("Expected [stream quota exceeded], got", v["error"])
+	}
+}
+
+func TestServerVersions(t *testing.T) {
+	key, _ := address.NewKey()
+	testnet, _ := key.AddressVersion(key.PublicKey(), address.TestnetVersion)
+
+	resp := newStream(t, testnet)
+	if v := decodeResponse(t, resp); v["error"] != "address version testnet not accepted by this server" {
+		t.Error("Expected testnet to be refused, got", v)
+	}
+
+	ts := httptest.NewServer(NewServer(Config{
+		Store:    NewMemoryStore(),
+		Versions: []byte{address.TestnetVersion},
+	}))
+	defer ts.Close()
+
+	resp = postMap(t, map[string]string{"address": testnet}, ts.URL+APP)
+	if resp.StatusCode != 201 {
+		t.Error("Expected 201, got", resp.StatusCode)
+	}
+}
+
+func TestStreamAddressPath(t *testing.T) {
+	parent := t.TempDir()
+	storeRoot := filepath.Join(parent, "root")
+	os.Mkdir(storeRoot, 0755)
+	ts := httptest.NewServer(NewServer(Config{Root: storeRoot, AllowDelete: true}))
+	defer ts.Close()
+
+	for _, a := range []string{"..", ".", "%2E%2E", "..%2F..", "a%2Fb"} {
+		uri := ts.URL + APP + "/" + a
+		for _, test := range []struct {
+			method string
+			uri    string
+		}{
+			{"POST", uri + "/message"},
+			{"GET", uri},
+			{"GET", uri + "/index"},
+			{"GET", uri + "/message/1"},
+			{"GET", uri + "/events"},
+			{"DELETE", uri + "/message/1"},
+			{"DELETE", uri},
+		} {
+			req, _ := http.NewRequest(test.method, test.uri, strings.NewReader("x"))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal("error in request", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != 404 {
+				t.Errorf("%s %s: expected 404, got %d", test.method, test.uri, resp.StatusCode)
+			}
+		}
+	}
+
+	for _, dir := range []string{parent, storeRoot} {
+		if _, err := os.Stat(filepath.Join(dir, "00000000000000000001")); !os.IsNotExist(err) {
+			t.Error("message written to", dir)
+		}
+	}
+	if _, err := os.Stat(storeRoot); err != nil {
+		t.Error("root removed", err)
+	}
+}
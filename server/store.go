@@ -0,0 +1,125 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrExists   = errors.New("already exists")
+	ErrNotFound = errors.New("not found")
+)
+
+// Message describes a stored message.
+type Message struct {
+	// Seq is the position of the message within its stream. The first
+	// message has Seq 1 and every later message the next integer.
+	Seq uint64
+
+	// Time is when the server accepted the message.
+	Time time.Time
+
+	// Size is the length of the message in bytes.
+	Size int64
+}
+
+// ID returns the message-id of m as used in the Stream API.
+func (m Message) ID() string {
+	return strconv.FormatUint(m.Seq, 10)
+}
+
+// ParseID converts a message-id from the Stream API into a sequence number.
+func ParseID(id string) (uint64, error) {
+	return strconv.ParseUint(id, 10, 64)
+}
+
+// StreamInfo is what a Store records about a stream besides its messages.
+type StreamInfo struct {
+	// Verifier is the ed25519 public key requests to the stream must be
+	// signed with. Empty when the stream does not require signatures.
+	Verifier []byte `json:"verifier,omitempty"`
+
+	// Retention limits how long the stream's messages are kept.
+	Retention Retention `json:"retention,omitempty"`
+}
+
+// Usage is how much a stream holds.
+type Usage struct {
+	Messages int
+	Bytes    int64
+}
+
+// A Page selects a run of messages from a stream for Store.Range.
+type Page struct {
+	// After and Before bound the sequence numbers returned, exclusive.
+	// Zero means unbounded. Neither need be the Seq of an existing message.
+	After  uint64
+	Before uint64
+
+	// Count is the most messages returned. Zero means no limit.
+	Count int
+
+	// Reverse returns the newest messages first, so a page ends
+	// Count messages below Before instead of above After.
+	Reverse bool
+}
+
+// bounds clips p to a stream whose messages lie between first and last,
+// inclusive. ok is false when no message can be selected.
+func (p Page) bounds(first, last uint64) (lo, hi uint64, ok bool) {
+	lo, hi = first, last
+	if p.After >= lo {
+		lo = p.After + 1
+	}
+	if p.Before != 0 && p.Before <= hi {
+		hi = p.Before - 1
+	}
+
+	return lo, hi, first != 0 && lo <= hi
+}
+
+// A Store persists streams and their messages for a Server.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Register creates the stream address, recording info with it.
+	// Returns ErrExists if address is already registered.
+	Register(address string, info StreamInfo) error
+
+	// Info returns what was recorded when address was registered.
+	// Returns ErrNotFound if address is not registered.
+	Info(address string) (StreamInfo, error)
+
+	// Append adds the message read from r to address, assigning it the
+	// next sequence number. Returns ErrNotFound if address is not registered.
+	Append(address string, r io.Reader) (Message, error)
+
+	// Range returns the messages of address selected by p.
+	// Returns ErrNotFound if address is not registered.
+	Range(address string, p Page) ([]Message, error)
+
+	// Read returns message seq of address. The caller must close it.
+	// Returns ErrNotFound if either address or seq do not exist.
+	Read(address string, seq uint64) (io.ReadCloser, Message, error)
+
+	// Usage returns how much address holds.
+	// Returns ErrNotFound if address is not registered.
+	Usage(address string) (Usage, error)
+
+	// Delete removes message seq of address. Its sequence number is
+	// never reused. Returns ErrNotFound if either address or seq do
+	// not exist.
+	Delete(address string, seq uint64) error
+
+	// Remove deletes address and all of its messages.
+	// Returns ErrNotFound if address is not registered.
+	Remove(address string) error
+
+	// Streams returns the addresses of every registered stream.
+	Streams() ([]string, error)
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStore runs the same checks against any Store.
+func testStore(t *testing.T, store Store) {
+	if err := store.Register(streamAddress, StreamInfo{}); err != nil {
+		t.Fatal("error registering", err)
+	}
+
+	if err := store.Register(streamAddress, StreamInfo{}); err != ErrExists {
+		t.Error("expected ErrExists, got", err)
+	}
+
+	for _, a := range []string{"Snotthere", "..", "."} {
+		if _, err := store.Append(a, strings.NewReader("x")); err != ErrNotFound {
+			t.Errorf("%s: expected ErrNotFound, got %v", a, err)
+		}
+		if _, _, err := store.Read(a, 1); err != ErrNotFound {
+			t.Errorf("%s: expected ErrNotFound, got %v", a, err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		m, err := store.Append(streamAddress, strings.NewReader("message "+strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal("error appending", err)
+		}
+		if m.Seq != uint64(i+1) {
+			t.Errorf("expected seq %d, got %d", i+1, m.Seq)
+		}
+		if time.Since(m.Time) > time.Minute {
+			t.Error("unexpected message time", m.Time)
+		}
+	}
+
+	list, err := store.Range(streamAddress, Page{})
+	if err != nil {
+		t.Fatal("error listing", err)
+	}
+
+	if len(list) != 3 || list[0].Seq != 1 || list[2].Seq != 3 {
+		t.Errorf("expected seq 1 to 3, got %v", list)
+	}
+
+	msg, m, err := store.Read(streamAddress, 2)
+	if err != nil {
+		t.Fatal("error reading", err)
+	}
+	defer msg.Close()
+
+	data, _ := ioutil.ReadAll(msg)
+	if string(data) != "message 1" {
+		t.Error("expected [message 1], got", string(data))
+	}
+
+	if !m.Time.Equal(list[1].Time) {
+		t.Errorf("expected time %v, got %v", list[1].Time, m.Time)
+	}
+
+	if _, _, err := store.Read(streamAddress, 4); err != ErrNotFound {
+		t.Error("expected ErrNotFound, got", err)
+	}
+
+	pages := []struct {
+		page Page
+		want []uint64
+	}{
+		{Page{After: 1}, []uint64{2, 3}},
+		{Page{Before: 3}, []uint64{1, 2}},
+		{Page{After: 1, Before: 3}, []uint64{2}},
+		{Page{After: 3}, nil},
+		{Page{Count: 2}, []uint64{1, 2}},
+		{Page{Count: 2, Reverse: true}, []uint64{3, 2}},
+		{Page{Before: 3, Reverse: true}, []uint64{2, 1}},
+		{Page{After: 1, Before: 9, Reverse: true}, []uint64{3, 2}},
+	}
+	for _, p := range pages {
+		list, err := store.Range(streamAddress, p.page)
+		if err != nil {
+			t.Fatal("error listing", err)
+		}
+
+		got := []uint64{}
+		for _, m := range list {
+			got = append(got, m.Seq)
+		}
+		if len(got) != len(p.want) {
+			t.Errorf("%+v: expected %v, got %v", p.page, p.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != p.want[i] {
+				t.Errorf("%+v: expected %v, got %v", p.page, p.want, got)
+				break
+			}
+		}
+	}
+
+	if _, err := store.Range("Snotthere", Page{}); err != ErrNotFound {
+		t.Error("expected ErrNotFound, got", err)
+	}
+}
+
+// testStoreConcurrent checks sequence numbers stay gap free
+// when many messages are appended at once.
+func testStoreConcurrent(t *testing.T, store Store) {
+	if err := store.Register(streamAddress, StreamInfo{}); err != nil {
+		t.Fatal("error registering", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.Append(streamAddress, strings.NewReader("message")); err != nil {
+				t.Error("error appending", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	list, _ := store.Range(streamAddress, Page{})
+	for i, m := range list {
+		if m.Seq != uint64(i+1) {
+			t.Fatalf("expected seq %d, got %d", i+1, m.Seq)
+		}
+	}
+	if len(list) != 50 {
+		t.Error("expected 50 messages, got", len(list))
+	}
+}
+
+// testStoreDelete checks deleted messages stay gone and
+// their sequence numbers are not reused.
+func testStoreDelete(t *testing.T, store Store) {
+	if err := store.Register(streamAddress, StreamInfo{}); err != nil {
+		t.Fatal("error registering", err)
+	}
+	for i := 0; i < 4; i++ {
+		store.Append(streamAddress, strings.NewReader("message "+strconv.Itoa(i)))
+	}
+
+	for _, seq := range []uint64{1, 4} {
+		if err := store.Delete(streamAddress, seq); err != nil {
+			t.Fatal("error deleting", err)
+		}
+	}
+	if err := store.Delete(streamAddress, 4); err != ErrNotFound {
+		t.Error("expected ErrNotFound, got", err)
+	}
+
+	list, _ := store.Range(streamAddress, Page{})
+	if len(list) != 2 || list[0].Seq != 2 || list[1].Seq != 3 {
+		t.Errorf("expected seq 2 and 3, got %v", list)
+	}
+	if list[0].Size != int64(len("message 1")) {
+		t.Error("expected size 9, got", list[0].Size)
+	}
+
+	m, err := store.Append(streamAddress, strings.NewReader("message 4"))
+	if err != nil {
+		t.Fatal("error appending", err)
+	}
+	if m.Seq != 5 {
+		t.Error("expected seq 5, got", m.Seq)
+	}
+
+	addresses, _ := store.Streams()
+	if len(addresses) != 1 || addresses[0] != streamAddress {
+		t.Error("expected one stream, got", addresses)
+	}
+
+	if err := store.Remove(streamAddress); err != nil {
+		t.Fatal("error removing", err)
+	}
+	if _, err := store.Info(streamAddress); err != ErrNotFound {
+		t.Error("expected ErrNotFound, got", err)
+	}
+	if err := store.Remove(streamAddress); err != ErrNotFound {
+		t.Error("expected ErrNotFound, got", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, NewFileStore(t.TempDir()))
+	testStoreConcurrent(t, NewFileStore(t.TempDir()))
+	testStoreDelete(t, NewFileStore(t.TempDir()))
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+	testStoreConcurrent(t, NewMemoryStore())
+	testStoreDelete(t, NewMemoryStore())
+}
+
+// deleting the newest message must survive a restart
+func TestFileStoreDeleteLast(t *testing.T) {
+	root := t.TempDir()
+	store := NewFileStore(root)
+	store.Register(streamAddress, StreamInfo{})
+	store.Append(streamAddress, strings.NewReader("one"))
+	store.Append(streamAddress, strings.NewReader("two"))
+	if err := store.Delete(streamAddress, 2); err != nil {
+		t.Fatal("error deleting", err)
+	}
+
+	m, err := NewFileStore(root).Append(streamAddress, strings.NewReader("three"))
+	if err != nil {
+		t.Fatal("error appending", err)
+	}
+	if m.Seq != 3 {
+		t.Error("expected seq 3, got", m.Seq)
+	}
+}
+
+func TestFileStoreLegacy(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, streamAddress), 0755)
+
+	// timestamp named messages, written out of order
+	times := []string{
+		"2016-06-02T10:00:00.5Z",
+		"2016-06-01T10:00:00.123456789Z",
+		"2016-06-02T10:00:00.25Z",
+	}
+	for _, name := range times {
+		ioutil.WriteFile(filepath.Join(root, streamAddress, name), []byte(name), 0644)
+	}
+
+	store := NewFileStore(root)
+	m, err := store.Append(streamAddress, strings.NewReader("new"))
+	if err != nil {
+		t.Fatal("error appending", err)
+	}
+	if m.Seq != 4 {
+		t.Error("expected seq 4, got", m.Seq)
+	}
+
+	for seq, want := range []string{times[1], times[2], times[0]} {
+		msg, m, err := store.Read(streamAddress, uint64(seq+1))
+		if err != nil {
+			t.Fatal("error reading", err)
+		}
+		data, _ := ioutil.ReadAll(msg)
+		msg.Close()
+
+		if string(data) != want {
+			t.Errorf("expected [%s], got [%s]", want, data)
+		}
+		if m.Time.Format(time.RFC3339Nano) != want {
+			t.Errorf("expected time %s, got %v", want, m.Time)
+		}
+	}
+}
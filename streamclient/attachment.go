@@ -0,0 +1,204 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package streamclient
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+
+	"github.com/macfisherman/streammail/address"
+)
+
+// ChunkSize is the size of attachment chunks. Each is a message, so it
+// has to be less than the largest message the server accepts.
+const ChunkSize = 256 << 10
+
+var (
+	// ErrAttachmentChunk is returned by Open for the messages holding
+	// attachment chunks, which are read with ReadAttachment.
+	ErrAttachmentChunk = errors.New("message is an attachment chunk")
+
+	ErrAttachment = errors.New("attachment does not match its manifest")
+)
+
+// An Attachment is the manifest of a file sent in a stream. The content
+// is in Chunks, messages of up to ChunkSize bytes each encrypted with
+// the random Key of the attachment. The manifest is an "attachment"
+// Control, sealed like any message, so only the parties learn the Key.
+type Attachment struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+
+	// SHA256 is the hex digest of the content.
+	SHA256 string `json:"sha256"`
+
+	// Key is the base64 key of the ChunkSealer.
+	Key string `json:"key"`
+
+	// Chunks are the 'ids' of the chunk messages, in order.
+	Chunks []string `json:"chunks"`
+
+	// Padded tells that the final chunk was padded by address.Pad, the
+	// others all being ChunkSize, so the server cannot tell the Size.
+	Padded bool `json:"padded,omitempty"`
+}
+
+// sealer returns the ChunkSealer of a.
+func (a *Attachment) sealer() (*address.ChunkSealer, error) {
+	key, err := base64.StdEncoding.DecodeString(a.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := hex.DecodeString(a.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return address.NewChunkSealer(key, id)
+}
+
+// SendAttachment posts the content of r, up to its end, in encrypted
+// chunks, then the manifest. Only two chunks are held in memory at a time.
+// With a Padding, the final chunk is padded.
+func (s *SecureStream) SendAttachment(name string, r io.Reader) (*Attachment, error) {
+	id := make([]byte, 16)
+	key := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	a := &Attachment{
+		ID:   hex.EncodeToString(id),
+		Name: name,
+		Key:  base64.StdEncoding.EncodeToString(key),
+	}
+
+	sealer, err := a.sealer()
+	if err != nil {
+		return nil, err
+	}
+
+	// read a chunk ahead, to know which is final
+	digest := sha256.New()
+	chunk, err := readChunk(r)
+	for err == nil {
+		var next []byte
+		if next, err = readChunk(r); err != nil {
+			break
+		}
+
+		final := len(next) == 0
+		if err = s.postChunk(a, sealer, chunk, final, digest); err != nil || final {
+			break
+		}
+		chunk = next
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	if err := s.sendControl(Control{Type: "attachment", Attachment: a}, s.Sign); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// readChunk reads up to ChunkSize bytes, returning none at the end of r.
+func readChunk(r io.Reader) ([]byte, error) {
+	chunk := make([]byte, ChunkSize)
+	n, err := io.ReadFull(r, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	return chunk[:n], err
+}
+
+// postChunk seals and posts the next chunk of a. An empty attachment
+// is a single empty chunk.
+func (s *SecureStream) postChunk(a *Attachment, sealer *address.ChunkSealer, chunk []byte, final bool, digest hash.Hash) error {
+	plaintext := chunk
+	if final && s.Padding != nil {
+		padded, err := address.Pad(chunk, s.Padding)
+		if err != nil {
+			return err
+		}
+		plaintext = padded
+		a.Padded = true
+	}
+
+	envelope, err := sealer.Seal(uint32(len(a.Chunks)), final, plaintext)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.Post(envelope)
+	if err != nil {
+		return err
+	}
+
+	digest.Write(chunk)
+	a.Size += int64(len(chunk))
+	a.Chunks = append(a.Chunks, id)
+	return nil
+}
+
+// ReadAttachment writes the content of a to w, a chunk at a time. Every
+// chunk is authenticated before it is written, and the size and digest
+// are checked at the end; on error, what was written should be discarded.
+func (s *SecureStream) ReadAttachment(a *Attachment, w io.Writer) error {
+	if len(a.Chunks) == 0 {
+		return ErrAttachment
+	}
+
+	sealer, err := a.sealer()
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.New()
+	var size int64
+	for i, id := range a.Chunks {
+		envelope, err := s.GetMessage(id)
+		if err != nil {
+			return err
+		}
+
+		final := i == len(a.Chunks)-1
+		chunk, err := sealer.Open(uint32(i), final, envelope)
+		if err != nil {
+			return err
+		}
+		if final && a.Padded {
+			if chunk, err = address.Unpad(chunk); err != nil {
+				return err
+			}
+		}
+
+		digest.Write(chunk)
+		size += int64(len(chunk))
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	if size != a.Size || hex.EncodeToString(digest.Sum(nil)) != a.SHA256 {
+		return ErrAttachment
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package streamclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/macfisherman/streammail/address"
+)
+
+var (
+	ErrContactExists = errors.New("contact already exists")
+	ErrNoContact     = errors.New("no such contact")
+	ErrNoPeer        = errors.New("contact has no public key yet")
+)
+
+// A Contact is a relationship with another party. Each Contact has its
+// own Key, so contacts cannot tell from the public keys they were given
+// that they talk to the same user, and a Key that leaks exposes only the
+// stream with that contact.
+type Contact struct {
+	Name string
+
+	// Key is used with this contact only.
+	Key *address.Key
+
+	// Peer is the contact's public key, nil until they gave it.
+	Peer *address.Public
+
+	// Address is the stream address of Key and Peer, empty without Peer.
+	Address string
+}
+
+// SecureStream returns the SecureStream with the contact on the
+// server at uri.
+func (c *Contact) SecureStream(uri string) (*SecureStream, error) {
+	if c.Peer == nil {
+		return nil, ErrNoPeer
+	}
+
+	return NewSecureStream(uri, c.Key, c.Peer)
+}
+
+// Contacts is a local registry of Contacts, kept in a file. Private keys
+// are stored encrypted with the passphrase given to OpenContacts, and
+// only decrypted when their Contact is asked for.
+type Contacts struct {
+	mu         sync.Mutex
+	filename   string
+	passphrase []byte
+	keychain   *address.Keychain
+	entries    map[string]contactEntry
+}
+
+// contactEntry is a Contact as stored in the file.
+type contactEntry struct {
+	Key     string `json:"key"`
+	Peer    string `json:"peer,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+// OpenContacts reads the registry in filename, or starts an empty one if
+// the file does not exist. New keys are derived from keychain, so they
+// can be restored from its mnemonic, or generated at random when
+// keychain is nil.
+func OpenContacts(filename string, passphrase []byte, keychain *address.Keychain) (*Contacts, error) {
+	c := &Contacts{
+		filename:   filename,
+		passphrase: passphrase,
+		keychain:   keychain,
+		entries:    make(map[string]contactEntry),
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Add creates a Contact called name with a new Key of type t. Hand
+// Contact.Key.PublicKey() to the contact, and their key to SetPeer.
+func (c *Contacts) Add(name string, t address.KeyType) (*Contact, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[name]; ok {
+		return nil, ErrContactExists
+	}
+
+	var key *address.Key
+	var err error
+	if c.keychain != nil {
+		key, err = c.keychain.ContactKey(t, name)
+	} else {
+		key, err = address.NewKeyType(t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := key.MarshalPEM(c.passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	c.entries[name] = contactEntry{Key: string(data)}
+	if err := c.save(); err != nil {
+		delete(c.entries, name)
+		return nil, err
+	}
+
+	return &Contact{Name: name, Key: key}, nil
+}
+
+// SetPeer records the public key of contact name and with it
+// the address of their stream.
+func (c *Contacts) SetPeer(name string, peer *address.Public) (*Contact, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	contact, err := c.contact(name)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := contact.Key.Address(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	old := c.entries[name]
+	entry := old
+	entry.Peer = peer.String()
+	entry.Address = addr
+	c.entries[name] = entry
+	if err := c.save(); err != nil {
+		c.entries[name] = old
+		return nil, err
+	}
+
+	contact.Peer = peer
+	contact.Address = addr
+	return contact, nil
+}
+
+// Get returns the Contact called name.
+func (c *Contacts) Get(name string) (*Contact, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.contact(name)
+}
+
+// ByAddress returns the Contact whose stream has address addr.
+func (c *Contacts) ByAddress(addr string) (*Contact, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, entry := range c.entries {
+		if entry.Address == addr {
+			return c.contact(name)
+		}
+	}
+
+	return nil, ErrNoContact
+}
+
+// Names returns the names of all contacts, sorted.
+func (c *Contacts) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.entries))
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Remove forgets contact name and their Key.
+func (c *Contacts) Remove(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old, ok := c.entries[name]
+	if !ok {
+		return ErrNoContact
+	}
+
+	delete(c.entries, name)
+	if err := c.save(); err != nil {
+		c.entries[name] = old
+		return err
+	}
+
+	return nil
+}
+
+// contact decodes the entry of name. The caller must hold c.mu.
+func (c *Contacts) contact(name string) (*Contact, error) {
+	entry, ok := c.entries[name]
+	if !ok {
+		return nil, ErrNoContact
+	}
+
+	key, err := address.ParseKey([]byte(entry.Key), c.passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	contact := &Contact{Name: name, Key: key, Address: entry.Address}
+	if entry.Peer != "" {
+		if contact.Peer, err = address.ParsePublic(entry.Peer); err != nil {
+			return nil, err
+		}
+	}
+
+	return contact, nil
+}
+
+// save writes the registry to a temporary file then renames it over the
+// old one, so a failed write never loses contacts. The caller must
+// hold c.mu.
+func (c *Contacts) save() error {
+	data, err := json.MarshalIndent(c.entries, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.filename), filepath.Base(c.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.filename)
+}
@@ -0,0 +1,243 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package streamclient
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/macfisherman/streammail/address"
+)
+
+// MaxGroupMembers is the most members a Group may have.
+const MaxGroupMembers = 50
+
+var (
+	ErrGroupSize   = errors.New("group has too many members")
+	ErrMember      = errors.New("already a member of the group")
+	ErrNotMember   = errors.New("not a member of the group")
+	ErrGroupInvite = errors.New("message is not a group invite")
+)
+
+// A Group is a stream among up to MaxGroupMembers parties. Its address
+// and keys come from a random address.GroupKey, which a member sends
+// to each other member as a "group" Control over the stream they share;
+// see Invite and Distribute.
+//
+// Adding or removing members makes the next epoch of the group: a new
+// GroupKey, and so a new stream, sent only to the members of the new
+// epoch. Removed members keep the streams of the epochs they were in.
+type Group struct {
+	// ID names the group across epochs.
+	ID   string
+	Name string
+
+	// Epoch counts the rekeys of the group.
+	Epoch int
+	Key   *address.GroupKey
+
+	// Members are the public keys of every member, including the
+	// one holding the Group. Signed messages are verified with them.
+	Members []*address.Public
+
+	// Previous is the address of the stream of the previous epoch.
+	Previous string
+}
+
+// groupJSON is the form of a Group in invites.
+type groupJSON struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Epoch    int      `json:"epoch"`
+	Key      string   `json:"key"`
+	Members  []string `json:"members"`
+	Previous string   `json:"previous,omitempty"`
+}
+
+// NewGroup creates a Group called name of self and members.
+func NewGroup(name string, self *address.Key, members ...*address.Public) (*Group, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	g := &Group{ID: hex.EncodeToString(id), Name: name, Epoch: -1}
+	return g.rekey(append([]*address.Public{self.PublicKey()}, members...))
+}
+
+// Address returns the address of the group stream.
+func (g *Group) Address() string {
+	return g.Key.Address()
+}
+
+// Member tells whether p is one of the Members.
+func (g *Group) Member(p *address.Public) bool {
+	return g.member(p) >= 0
+}
+
+func (g *Group) member(p *address.Public) int {
+	if p == nil {
+		return -1
+	}
+
+	for i, m := range g.Members {
+		if bytes.Equal(m.MarshalCompressed(), p.MarshalCompressed()) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Add returns the next epoch of g, with members added.
+func (g *Group) Add(members ...*address.Public) (*Group, error) {
+	for _, m := range members {
+		if g.Member(m) {
+			return nil, ErrMember
+		}
+	}
+
+	return g.rekey(append(append([]*address.Public{}, g.Members...), members...))
+}
+
+// Remove returns the next epoch of g, without member.
+func (g *Group) Remove(member *address.Public) (*Group, error) {
+	i := g.member(member)
+	if i < 0 {
+		return nil, ErrNotMember
+	}
+
+	members := append([]*address.Public{}, g.Members[:i]...)
+	return g.rekey(append(members, g.Members[i+1:]...))
+}
+
+// rekey returns the next epoch of g, with members and a new GroupKey.
+func (g *Group) rekey(members []*address.Public) (*Group, error) {
+	if len(members) > MaxGroupMembers {
+		return nil, ErrGroupSize
+	}
+
+	key, err := address.NewGroupKey()
+	if err != nil {
+		return nil, err
+	}
+
+	next := &Group{ID: g.ID, Name: g.Name, Epoch: g.Epoch + 1, Key: key, Members: members}
+	if g.Key != nil {
+		next.Previous = g.Address()
+	}
+
+	return next, nil
+}
+
+// Stream returns the SecureStream of the group on the server at uri, for
+// self. The member creating the Group registers it. Messages are signed,
+// so each is attributed to its member, see Received.From.
+func (g *Group) Stream(uri string, self *address.Key) (*SecureStream, error) {
+	sealer, err := g.Key.Sealer()
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := g.Key.AuthKey()
+	if err != nil {
+		return nil, err
+	}
+
+	stream := NewStream(uri, g.Address())
+	stream.Signer = signer
+	return &SecureStream{Stream: stream, Sign: true, sealer: sealer, key: self, members: g.Members}, nil
+}
+
+// Invite sends g over s, a stream with one of its members.
+func (g *Group) Invite(s *SecureStream) error {
+	if !g.Member(s.peer) {
+		return ErrNotMember
+	}
+
+	return s.sendControl(Control{Type: "group", Group: g}, s.Sign)
+}
+
+// Distribute invites every member other than self, over the
+// streams self shares with them on the server at uri.
+func (g *Group) Distribute(uri string, self *address.Key) error {
+	for _, m := range g.Members {
+		if bytes.Equal(m.MarshalCompressed(), self.PublicKey().MarshalCompressed()) {
+			continue
+		}
+
+		s, err := NewSecureStream(uri, self, m)
+		if err != nil {
+			return err
+		}
+		if err := g.Invite(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReceiveGroup gets message 'id' from s and returns the Group it invites
+// to. Only invites from members of the Group are accepted.
+func (s *SecureStream) ReceiveGroup(id string) (*Group, error) {
+	received, err := s.Open(id)
+	if err != nil {
+		return nil, err
+	}
+
+	c := received.Control
+	if c == nil || c.Type != "group" || c.Group == nil {
+		return nil, ErrGroupInvite
+	}
+	if !c.Group.Member(s.peer) {
+		return nil, ErrNotMember
+	}
+
+	return c.Group, nil
+}
+
+func (g *Group) MarshalJSON() ([]byte, error) {
+	j := groupJSON{
+		ID:       g.ID,
+		Name:     g.Name,
+		Epoch:    g.Epoch,
+		Key:      g.Key.String(),
+		Previous: g.Previous,
+	}
+	for _, m := range g.Members {
+		j.Members = append(j.Members, m.String())
+	}
+
+	return json.Marshal(j)
+}
+
+func (g *Group) UnmarshalJSON(data []byte) error {
+	var j groupJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if len(j.Members) > MaxGroupMembers {
+		return ErrGroupSize
+	}
+
+	key, err := address.ParseGroupKey(j.Key)
+	if err != nil {
+		return err
+	}
+
+	members := make([]*address.Public, len(j.Members))
+	for i, m := range j.Members {
+		if members[i], err = address.ParsePublic(m); err != nil {
+			return err
+		}
+	}
+
+	*g = Group{ID: j.ID, Name: j.Name, Epoch: j.Epoch, Key: key, Members: members, Previous: j.Previous}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package streamclient
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// An IndexQuery selects a page of message 'ids' for GetIndexPage.
+// Zero values are left for the server to choose.
+type IndexQuery struct {
+	// After and Before bound the 'ids' returned, exclusive.
+	// Neither need be an existing message.
+	After  string
+	Before string
+
+	// Reverse returns the newest 'ids' first.
+	Reverse bool
+
+	// Count is the most 'ids' returned. The server
+	// defaults to 100 and may cap it lower.
+	Count int
+
+	// Cursor continues a previous page, as returned by GetIndexPage.
+	// When set, After, Before and Reverse are ignored.
+	Cursor string
+}
+
+// Get a page of message 'ids' selected by q. next is the
+// Cursor of the following page, or "" when there is none.
+func (s *Stream) GetIndexPage(q IndexQuery) (ids []string, next string, err error) {
+	vars := url.Values{}
+	if q.Cursor != "" {
+		vars.Set("cursor", q.Cursor)
+	} else {
+		if q.After != "" {
+			vars.Set("after", q.After)
+		}
+		if q.Before != "" {
+			vars.Set("before", q.Before)
+		}
+		if q.Reverse {
+			vars.Set("order", "desc")
+		}
+	}
+	if q.Count > 0 {
+		vars.Set("count", strconv.Itoa(q.Count))
+	}
+
+	resp, err := s.get(s.BaseURI + "/" + s.Address + "/index?" + vars.Encode())
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, "", responseError(resp)
+	}
+
+	a, err := decodeResponseArray(resp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ids = make([]string, len(a))
+	for i := range ids {
+		ids[i] = a[i].(string)
+	}
+
+	return ids, resp.Header.Get("X-Stream-Cursor"), nil
+}
+
+// An Iterator walks every message 'id' of a Stream,
+// fetching pages from the server as needed.
+//
+//	it := stream.Iterate(IndexQuery{Reverse: true})
+//	for it.Next() {
+//		id := it.ID()
+//	}
+//	if it.Err() != nil {
+//		...
+//	}
+type Iterator struct {
+	stream *Stream
+	query  IndexQuery
+	ids    []string
+	done   bool
+	err    error
+}
+
+// Iterate over the message 'ids' selected by q. q.Count sets the page size.
+func (s *Stream) Iterate(q IndexQuery) *Iterator {
+	return &Iterator{stream: s, query: q}
+}
+
+// Advance to the next 'id', returning false at the end or on error.
+func (it *Iterator) Next() bool {
+	if len(it.ids) > 0 {
+		it.ids = it.ids[1:]
+	}
+
+	for len(it.ids) == 0 && !it.done && it.err == nil {
+		ids, next, err := it.stream.GetIndexPage(it.query)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.ids = ids
+		it.query.Cursor = next
+		it.done = next == ""
+	}
+
+	return len(it.ids) > 0
+}
+
+// The current 'id'. Only valid after Next returns true.
+func (it *Iterator) ID() string {
+	return it.ids[0]
+}
+
+// The error that stopped the Iterator, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
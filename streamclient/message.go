@@ -0,0 +1,138 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package streamclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// MessageVersion is the version of the Message format.
+const MessageVersion = 1
+
+// DefaultContentType is the ContentType of a Message without one.
+const DefaultContentType = "text/plain; charset=utf-8"
+
+// messagePrefix starts the plaintext of structured messages, followed by
+//
+//	HEADER || "\n" || BODY
+//
+// HEADER being a messageHeader as JSON, which holds no newline.
+const messagePrefix = "\x00stream-message\n"
+
+var (
+	ErrMessageFormat  = errors.New("invalid structured message")
+	ErrMessageVersion = errors.New("unknown structured message version")
+)
+
+// A Message is a message with metadata, for clients that show more than
+// text: what the body is, when it was written, and which messages it
+// answers or replaces. The server only ever stores it sealed.
+type Message struct {
+	// ContentType is the MIME type of Body, DefaultContentType if empty.
+	ContentType string
+
+	// Time is when the sender composed the message, by its own clock.
+	// The server's time is in the X-Stream-Time header.
+	Time time.Time
+
+	// ReplyTo is the 'id' of the message this one answers, in the
+	// same stream, making threads.
+	ReplyTo string
+
+	// Replaces is the 'id' of an earlier message of the same sender
+	// that this one edits.
+	Replaces string
+
+	Subject string
+	Body    []byte
+}
+
+// messageHeader is the form of a Message's metadata.
+type messageHeader struct {
+	Version     int       `json:"version"`
+	ContentType string    `json:"content_type,omitempty"`
+	Time        time.Time `json:"time"`
+	ReplyTo     string    `json:"reply_to,omitempty"`
+	Replaces    string    `json:"replaces,omitempty"`
+	Subject     string    `json:"subject,omitempty"`
+}
+
+// NewMessage creates a Message with body, of contentType, composed now.
+func NewMessage(contentType string, body []byte) *Message {
+	return &Message{ContentType: contentType, Time: time.Now().UTC(), Body: body}
+}
+
+// Type returns the ContentType of m, or DefaultContentType.
+func (m *Message) Type() string {
+	if m.ContentType == "" {
+		return DefaultContentType
+	}
+	return m.ContentType
+}
+
+// MarshalBinary encodes m as the plaintext of a structured message.
+func (m *Message) MarshalBinary() ([]byte, error) {
+	header, err := json.Marshal(messageHeader{
+		Version:     MessageVersion,
+		ContentType: m.ContentType,
+		Time:        m.Time,
+		ReplyTo:     m.ReplyTo,
+		Replaces:    m.Replaces,
+		Subject:     m.Subject,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data := append([]byte(messagePrefix), header...)
+	data = append(data, '\n')
+	return append(data, m.Body...), nil
+}
+
+// UnmarshalBinary decodes a structured message encoded by MarshalBinary.
+func (m *Message) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(messagePrefix)) {
+		return ErrMessageFormat
+	}
+	data = data[len(messagePrefix):]
+
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return ErrMessageFormat
+	}
+
+	var h messageHeader
+	if err := json.Unmarshal(data[:i], &h); err != nil {
+		return ErrMessageFormat
+	}
+	if h.Version != MessageVersion {
+		return ErrMessageVersion
+	}
+
+	*m = Message{
+		ContentType: h.ContentType,
+		Time:        h.Time,
+		ReplyTo:     h.ReplyTo,
+		Replaces:    h.Replaces,
+		Subject:     h.Subject,
+		Body:        append([]byte{}, data[i+1:]...),
+	}
+	return nil
+}
+
+// SendMessage seals m and posts it to the server. Clients that do not
+// know structured messages get the whole plaintext, header and all, so
+// send plain messages with Send to peers that may use such clients.
+func (s *SecureStream) SendMessage(m *Message) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return s.send(data, s.Sign)
+}
@@ -0,0 +1,214 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package streamclient
+
+import (
+	"errors"
+
+	"github.com/macfisherman/streammail/address"
+)
+
+var (
+	// ErrRotation is returned for a rotate control message whose
+	// address is not the one its key derives.
+	ErrRotation = errors.New("rotation address does not match its key")
+
+	// ErrRotationUnsigned is returned by Follow for rotate control
+	// messages not signed by a party of the stream. They may be
+	// followed with FollowConfirmed.
+	ErrRotationUnsigned = errors.New("rotation is not signed by a party of the stream")
+
+	// ErrFingerprint is returned by FollowConfirmed when the new
+	// key's fingerprint is not the one the user confirmed.
+	ErrFingerprint = errors.New("fingerprint of the new key does not match")
+)
+
+// Rotate moves the conversation to a new stream between newKey and the
+// peer, for when the key of s may be compromised. The new stream is
+// registered, then announced in s with a "rotate" Control sealed with
+// the old secret and signed, and returned. Messages should only be sent
+// on the new stream from then on.
+//
+// Anyone holding the old key can send a signed rotate too, so the peer
+// should check the new key's Fingerprint before trusting the new stream.
+func (s *SecureStream) Rotate(newKey *address.Key) (*SecureStream, error) {
+	next, err := NewSecureStream(s.BaseURI, newKey, s.peer)
+	if err != nil {
+		return nil, err
+	}
+	next.Retention = s.Retention
+	next.Sign = s.Sign
+	next.RequireSigned = s.RequireSigned
+	next.Padding = s.Padding
+
+	if err := next.Register(); err != nil {
+		return nil, err
+	}
+
+	control := Control{Type: "rotate", Key: newKey.PublicKey().String(), Address: next.Address}
+	if err := s.sendControl(control, true); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
+
+// Follow returns the stream announced by the rotate Control of r, opened
+// from s. Only rotates signed by a party of s are followed; others return
+// ErrRotationUnsigned. A rotate signed by the peer moves to a stream
+// between the user's key and the peer's new key. One signed by the user
+// moves to a stream between the new key, which must be one of keys, the
+// user's own, and the peer.
+func (s *SecureStream) Follow(r *Received, keys ...*address.Key) (*SecureStream, error) {
+	if r.Control == nil || r.Control.Type != "rotate" {
+		return nil, ErrRotation
+	}
+
+	switch r.Sender {
+	case SenderPeer:
+		return s.follow(r.Control, nil)
+	case SenderSelf:
+		for _, k := range keys {
+			if k.PublicKey().String() == r.Control.Key {
+				return s.follow(r.Control, keys)
+			}
+		}
+		return nil, ErrRotation
+	}
+
+	return nil, ErrRotationUnsigned
+}
+
+// FollowConfirmed returns the stream announced by the rotate Control c,
+// signed or not, once the user has confirmed the new key: fingerprint is
+// the Fingerprint of the new stream's keys, as compared with the other
+// party. keys are as for Follow.
+func (s *SecureStream) FollowConfirmed(c *Control, fingerprint string, keys ...*address.Key) (*SecureStream, error) {
+	if c == nil || c.Type != "rotate" {
+		return nil, ErrRotation
+	}
+
+	next, err := s.follow(c, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	got, err := next.key.Fingerprint(next.peer)
+	if err != nil {
+		return nil, err
+	}
+	if got != fingerprint {
+		return nil, ErrFingerprint
+	}
+
+	return next, nil
+}
+
+// follow returns the stream announced by c. When its key is one of keys,
+// c was sent by the user; otherwise by the peer.
+func (s *SecureStream) follow(c *Control, keys []*address.Key) (*SecureStream, error) {
+	public, err := address.ParsePublic(c.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	key, peer := s.key, public
+	for _, k := range keys {
+		if k.PublicKey().String() == c.Key {
+			key, peer = k, s.peer
+			break
+		}
+	}
+
+	next, err := NewSecureStream(s.BaseURI, key, peer)
+	if err != nil {
+		return nil, err
+	}
+	if next.Address != c.Address {
+		return nil, ErrRotation
+	}
+
+	next.Retention = s.Retention
+	next.Sign = s.Sign
+	next.RequireSigned = s.RequireSigned
+	next.Padding = s.Padding
+	return next, nil
+}
+
+// A HistoryMessage is a message found by History.
+type HistoryMessage struct {
+	// Address and ID locate the message.
+	Address string
+	ID      string
+
+	Message []byte
+
+	// Sender is who signed the message, if anyone.
+	Sender Sender
+
+	// Structured is set for structured messages, Message being its Body.
+	Structured *Message
+
+	// Attachment is set instead of Message for attachment manifests.
+	// Its chunks are in the stream at Address.
+	Attachment *Attachment
+}
+
+// History reads the messages of the conversation starting at s, in
+// order. At the end of each stream, History follows the first rotate
+// Control found in it that Follow accepts, if any, into the next stream;
+// unsigned rotates are skipped. keys are the user's own newer keys, see
+// Follow. The last stream of the chain is returned, for sending further
+// messages. With a Ratchet, messages sent by the user are left out, as
+// the Ratchet cannot open them. Attachment chunks are left out too,
+// their manifests standing for them.
+func (s *SecureStream) History(keys ...*address.Key) ([]HistoryMessage, *SecureStream, error) {
+	var messages []HistoryMessage
+	seen := map[string]bool{}
+
+	for {
+		seen[s.Address] = true
+
+		var next *SecureStream
+		it := s.Iterate(IndexQuery{})
+		for it.Next() {
+			received, err := s.Open(it.ID())
+			if err == address.ErrOwnMessage || err == ErrAttachmentChunk {
+				continue
+			}
+			if err != nil {
+				return messages, s, err
+			}
+
+			control := received.Control
+			if control == nil {
+				messages = append(messages, HistoryMessage{s.Address, it.ID(), received.Message, received.Sender, received.Structured, nil})
+			} else if control.Type == "attachment" && control.Attachment != nil {
+				messages = append(messages, HistoryMessage{s.Address, it.ID(), nil, received.Sender, nil, control.Attachment})
+			} else if control.Type == "rotate" && next == nil {
+				next, err = s.Follow(received, keys...)
+				if err == ErrRotationUnsigned {
+					continue
+				}
+				if err != nil {
+					return messages, s, err
+				}
+			}
+		}
+		if err := it.Err(); err != nil {
+			return messages, s, err
+		}
+
+		if next == nil {
+			return messages, s, nil
+		}
+		if seen[next.Address] {
+			// rotated back to a stream already read
+			return messages, next, nil
+		}
+
+		s = next
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package streamclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/macfisherman/streammail/address"
+)
+
+var (
+	// ErrControlMessage is returned by Receive for control messages,
+	// which are read with Open.
+	ErrControlMessage = errors.New("message is a control message")
+
+	// ErrSender is returned for signed messages whose key is
+	// not of a party of the stream.
+	ErrSender = errors.New("message signed by no party of the stream")
+
+	// ErrUnsigned is returned for unsigned messages when
+	// RequireSigned is set.
+	ErrUnsigned = errors.New("message is not signed")
+)
+
+// controlPrefix starts the plaintext of control messages, followed by
+// the Control as JSON. Send adds a zero byte to messages that start with
+// one, and Open removes it, so no message can be taken for a control
+// message.
+const controlPrefix = "\x00stream-control\n"
+
+// signedPrefix starts the plaintext of signed messages, followed by
+//
+//	KEY-LENGTH[1 byte] || KEY || SIGNATURE[64 bytes] || MESSAGE
+//
+// KEY being the compressed public key of the sender and MESSAGE the
+// plaintext as it would be unsigned. The signature is over signedInfo,
+// the stream address, KEY and MESSAGE, so it cannot be moved to another
+// stream.
+const signedPrefix = "\x00stream-signed\n"
+
+const signedInfo = "streammail/v1/signed\n"
+
+// paddedPrefix starts the plaintext of padded messages, followed by the
+// plaintext as it would be unpadded, padded by address.Pad. Padding is
+// the last layer before sealing, so it hides the size of signatures too.
+// Open removes exactly one such layer, so send pads any plaintext that
+// starts with paddedPrefix, even without a Padding.
+const paddedPrefix = "\x00stream-padded\n"
+
+// A Sender tells who wrote a message.
+type Sender int
+
+const (
+	// SenderUnknown is either party: the message was not signed.
+	SenderUnknown Sender = iota
+
+	// SenderSelf is the user of the SecureStream.
+	SenderSelf
+
+	// SenderPeer is the other party, or another member of a Group.
+	SenderPeer
+)
+
+func (s Sender) String() string {
+	switch s {
+	case SenderSelf:
+		return "self"
+	case SenderPeer:
+		return "peer"
+	}
+	return "unknown"
+}
+
+// A Received is a message opened by Open.
+type Received struct {
+	// Exactly one of Message and Control is set.
+	Message []byte
+	Control *Control
+
+	// Structured is set for structured messages, Message being its Body.
+	Structured *Message
+
+	// Sender is who signed the message, if anyone, and From their key.
+	Sender Sender
+	From   *address.Public
+}
+
+// A Control is a message from one client to the other, rather than
+// from one user to the other.
+type Control struct {
+	// Type is "rotate": the sender moved to a new stream, see Rotate,
+	// "group": an invite to a Group, or "attachment": the manifest of
+	// an Attachment, see SendAttachment.
+	Type string `json:"type"`
+
+	// Key is the new public key of the sender, in text form.
+	Key string `json:"key,omitempty"`
+
+	// Address is the new stream address.
+	Address string `json:"address,omitempty"`
+
+	// Group is the Group invited to, for type "group".
+	Group *Group `json:"group,omitempty"`
+
+	// Attachment is the manifest, for type "attachment".
+	Attachment *Attachment `json:"attachment,omitempty"`
+}
+
+// A SecureStream is a Stream whose messages are sealed with the
+// secret shared by the two parties before being posted, so the
+// server only ever stores ciphertext.
+type SecureStream struct {
+	*Stream
+
+	// Sign, set by NewSecureStream and Group.Stream, signs every
+	// message sent with the signing key of the long-term key, so the
+	// peer can tell who wrote it.
+	Sign bool
+
+	// RequireSigned makes Open refuse unsigned messages with
+	// ErrUnsigned, rather than return them from SenderUnknown.
+	RequireSigned bool
+
+	// Padding, when set, pads every message sent, so the server cannot
+	// tell its exact size. Padded messages open whatever the Padding.
+	Padding address.Padding
+
+	sealer  *address.Sealer
+	ratchet *address.Ratchet
+	key     *address.Key
+	peer    *address.Public
+	members []*address.Public
+}
+
+// Create a SecureStream between key and the owner of peer.
+// The Stream address, the message key and the key requests are
+// signed with are all derived from the ECDH secret of key and peer,
+// so once registered only the two parties can use the stream.
+func NewSecureStream(uri string, key *address.Key, peer *address.Public) (*SecureStream, error) {
+	addr, err := key.Address(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	sealer, err := key.Sealer(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := key.AuthKey(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := NewStream(uri, addr)
+	stream.Signer = signer
+	return &SecureStream{Stream: stream, Sign: true, sealer: sealer, key: key, peer: peer}, nil
+}
+
+// UseRatchet seals further messages with r, made by key.Ratchet(peer),
+// so each has its own key and reading the stream later, even with key,
+// does not expose them, except for the initiator's messages before the
+// first reply, see address.Ratchet.ForwardSecret. Messages sealed
+// without a Ratchet still open.
+// r can only open each message once; the caller saves r after every
+// Send and Receive, see address.Ratchet.MarshalBinary.
+func (s *SecureStream) UseRatchet(r *address.Ratchet) {
+	s.ratchet = r
+}
+
+// Seal message and post it to the server.
+func (s *SecureStream) Send(message []byte) error {
+	if len(message) > 0 && message[0] == 0 {
+		message = append([]byte{0}, message...)
+	}
+
+	return s.send(message, s.Sign)
+}
+
+// sendControl seals c and posts it to the server, signed when sign is set.
+func (s *SecureStream) sendControl(c Control, sign bool) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return s.send(append([]byte(controlPrefix), data...), sign)
+}
+
+func (s *SecureStream) send(plaintext []byte, sign bool) error {
+	if sign {
+		var err error
+		if plaintext, err = s.sign(plaintext); err != nil {
+			return err
+		}
+	}
+
+	padding := s.Padding
+	if padding == nil && bytes.HasPrefix(plaintext, []byte(paddedPrefix)) {
+		// only the 0x80, so Open does not take plaintext for padded
+		padding = address.BlockPadding(1)
+	}
+	if padding != nil {
+		padded, err := address.Pad(plaintext, padding)
+		if err != nil {
+			return err
+		}
+		plaintext = append([]byte(paddedPrefix), padded...)
+	}
+
+	seal := s.sealer.Seal
+	if s.ratchet != nil {
+		seal = s.ratchet.Seal
+	}
+
+	envelope, err := seal(plaintext)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Post(envelope)
+	return err
+}
+
+// sign wraps plaintext in a signed message, see signedPrefix.
+func (s *SecureStream) sign(plaintext []byte) ([]byte, error) {
+	key := s.key.PublicKey().MarshalCompressed()
+	sig, err := s.key.Sign(s.signedData(key, plaintext))
+	if err != nil {
+		return nil, err
+	}
+
+	signed := append([]byte(signedPrefix), byte(len(key)))
+	signed = append(signed, key...)
+	signed = append(signed, sig...)
+	return append(signed, plaintext...), nil
+}
+
+// verify unwraps a signed message, returning who signed it. A message
+// signed by a party whose signing key is not known is returned as from
+// SenderUnknown, as if it were unsigned.
+func (s *SecureStream) verify(signed []byte) (Sender, *address.Public, []byte, error) {
+	rest := signed[len(signedPrefix):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0])+address.SignatureSize {
+		return SenderUnknown, nil, nil, address.ErrSignature
+	}
+
+	key := rest[1 : 1+int(rest[0])]
+	sig := rest[1+len(key) : 1+len(key)+address.SignatureSize]
+	plaintext := rest[1+len(key)+address.SignatureSize:]
+
+	sender, public := SenderUnknown, (*address.Public)(nil)
+	if bytes.Equal(key, s.key.PublicKey().MarshalCompressed()) {
+		sender, public = SenderSelf, s.key.PublicKey()
+	} else {
+		for _, p := range append([]*address.Public{s.peer}, s.members...) {
+			if p != nil && bytes.Equal(key, p.MarshalCompressed()) {
+				sender, public = SenderPeer, p
+				break
+			}
+		}
+	}
+	if public == nil {
+		return SenderUnknown, nil, nil, ErrSender
+	}
+	if public.SignKey() == nil {
+		return SenderUnknown, nil, plaintext, nil
+	}
+
+	if err := public.Verify(s.signedData(key, plaintext), sig); err != nil {
+		return SenderUnknown, nil, nil, err
+	}
+
+	return sender, public, plaintext, nil
+}
+
+func (s *SecureStream) signedData(key, plaintext []byte) []byte {
+	data := append([]byte(signedInfo), s.Address...)
+	data = append(data, '\n')
+	data = append(data, key...)
+	return append(data, plaintext...)
+}
+
+// Get message 'id' from the server and open it.
+// Returns ErrControlMessage for control messages.
+func (s *SecureStream) Receive(id string) ([]byte, error) {
+	received, err := s.Open(id)
+	if err != nil {
+		return nil, err
+	}
+	if received.Control != nil {
+		return nil, ErrControlMessage
+	}
+
+	return received.Message, nil
+}
+
+// Get message 'id' from the server, open it and verify its signature,
+// if any. With a Ratchet, messages sent by this party return
+// address.ErrOwnMessage. Attachment chunks return ErrAttachmentChunk.
+func (s *SecureStream) Open(id string) (*Received, error) {
+	envelope, err := s.GetMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(envelope) > 0 && envelope[0] == address.EnvelopeChunk {
+		return nil, ErrAttachmentChunk
+	}
+
+	open := s.sealer.Open
+	if s.ratchet != nil && len(envelope) > 0 && envelope[0] == address.EnvelopeV2 {
+		open = s.ratchet.Open
+	}
+
+	plaintext, err := open(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(plaintext, []byte(paddedPrefix)) {
+		if plaintext, err = address.Unpad(plaintext[len(paddedPrefix):]); err != nil {
+			return nil, err
+		}
+	}
+
+	received := &Received{}
+	if bytes.HasPrefix(plaintext, []byte(signedPrefix)) {
+		if received.Sender, received.From, plaintext, err = s.verify(plaintext); err != nil {
+			return nil, err
+		}
+	}
+	if received.Sender == SenderUnknown && s.RequireSigned {
+		return nil, ErrUnsigned
+	}
+
+	if len(plaintext) == 0 || plaintext[0] != 0 {
+		received.Message = plaintext
+		return received, nil
+	}
+
+	if bytes.HasPrefix(plaintext, []byte(controlPrefix)) {
+		received.Control = &Control{}
+		if err := json.Unmarshal(plaintext[len(controlPrefix):], received.Control); err != nil {
+			return nil, err
+		}
+		return received, nil
+	}
+
+	if bytes.HasPrefix(plaintext, []byte(messagePrefix)) {
+		received.Structured = &Message{}
+		if err := received.Structured.UnmarshalBinary(plaintext); err != nil {
+			return nil, err
+		}
+		received.Message = received.Structured.Body
+		return received, nil
+	}
+
+	// a message that started with a zero byte, escaped by Send
+	if len(plaintext) > 1 && plaintext[1] == 0 {
+		plaintext = plaintext[1:]
+	}
+
+	received.Message = plaintext
+	return received, nil
+}
@@ -9,10 +9,15 @@ import (
 	"strconv"
 	"net/http"
 	"encoding/json"
+	"encoding/base64"
 	"bytes"
 	"io/ioutil"
 	"errors"
+	"crypto/ed25519"
+	"time"
 //	"fmt"
+
+	"github.com/macfisherman/streammail/address"
 )
 
 const VERSION = "v1"
@@ -23,6 +28,23 @@ const APP = "/"+API+"/"+VERSION
 type Stream struct {
 	BaseURI string
 	Address string
+
+	// Signer, when set, signs every request to the server. Register
+	// sends its public half as the stream's verifier, after which the
+	// server refuses unsigned requests for the stream.
+	Signer ed25519.PrivateKey
+
+	// Retention, when set, is sent by Register to limit the
+	// messages the server keeps for the stream.
+	Retention Retention
+}
+
+// Retention limits the messages a server keeps for a Stream, the
+// oldest being deleted first. Zero means no limit.
+type Retention struct {
+	MaxAge   time.Duration
+	MaxCount int
+	MaxBytes int64
 }
 
 // Helper function to decode a http.Response body that
@@ -50,25 +72,53 @@ func decodeResponseArray(r *http.Response) ([]interface{}, error) {
 	return v, nil
 }
 
+// Helper function to send a request, signing it with the
+// Stream's Signer if it has one. body must be what req sends.
+func (s *Stream) do(req *http.Request, body []byte) (*http.Response, error) {
+	if s.Signer != nil {
+		date := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Stream-Date", date)
+		req.Header.Set("X-Stream-Signature",
+			address.SignRequest(s.Signer, req.Method, req.URL.RequestURI(), date, body))
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
 // Helper function to POST a map to an HTTP endpoint.
-func postMap(d map[string]string, uri string) (*http.Response, error) {
+func (s *Stream) postMap(d map[string]interface{}, uri string) (*http.Response, error) {
 	buffer := new(bytes.Buffer)
 	json.NewEncoder(buffer).Encode(d)
-	return http.Post(uri, "application/json", buffer)
+	return s.postString(buffer.String(), uri)
 }
 
 // Helper function to POST a string to an HTTP endpoint.
-func postString(data string, uri string) (*http.Response, error) {
-	buffer := bytes.NewBufferString(data)
-	return http.Post(uri, "application/json", buffer)
+func (s *Stream) postString(data string, uri string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", uri, bytes.NewBufferString(data))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	return s.do(req, []byte(data))
+}
+
+// Helper function to POST bytes to an HTTP endpoint.
+func (s *Stream) postBytes(data []byte, uri string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return s.do(req, data)
 }
 
 // Helper function to GET an HTTP endpoint.
 // Sets the following headers:
 // Content-Type: application/stream+json
 // Accept: application/json
-func get(uri string) (*http.Response, error) {
-	client := &http.Client{}
+func (s *Stream) get(uri string) (*http.Response, error) {
 	req, err := http.NewRequest("GET", uri, nil)
 	if err != nil {
 		return nil, err
@@ -76,7 +126,48 @@ func get(uri string) (*http.Response, error) {
 
 	req.Header.Set("Content-Type", "application/stream+json") // vnd.api should be something stream specific?
 	req.Header.Set("Accept", "application/json")
-	return client.Do(req)
+	return s.do(req, nil)
+}
+
+// Helper function to DELETE an HTTP endpoint.
+func (s *Stream) delete(uri string) (*http.Response, error) {
+	req, err := http.NewRequest("DELETE", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	return s.do(req, nil)
+}
+
+// statusError is the error of a request the server answered with
+// an error status, as opposed to one that did not reach it.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// Helper function to turn an error response into an error.
+func responseError(resp *http.Response) error {
+	if resp.StatusCode == 404 {
+		return &statusError{resp.StatusCode, "not found"}
+	}
+
+	m, err := decodeResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	msg, ok := m["error"].(string)
+	if !ok {
+		return &statusError{resp.StatusCode, resp.Status}
+	}
+
+	return &statusError{resp.StatusCode, msg}
 }
 
 // Create a Stream object.
@@ -94,7 +185,24 @@ func NewStream(uri string, address string) *Stream {
 // with the server.
 // This only has to be done once with a server.
 func (s *Stream) Register() error {
-	resp, err := postMap(map[string]string{"address": s.Address}, s.BaseURI)
+	if err := address.Validate(s.Address); err != nil {
+		return err
+	}
+
+	fields := map[string]interface{}{"address": s.Address}
+	if s.Signer != nil {
+		verifier := s.Signer.Public().(ed25519.PublicKey)
+		fields["verifier"] = base64.RawURLEncoding.EncodeToString(verifier)
+	}
+	if s.Retention != (Retention{}) {
+		fields["retention"] = map[string]int64{
+			"max_age":   int64(s.Retention.MaxAge / time.Second),
+			"max_count": int64(s.Retention.MaxCount),
+			"max_bytes": s.Retention.MaxBytes,
+		}
+	}
+
+	resp, err := s.postMap(fields, s.BaseURI)
 	if err != nil {
 		return err
 	}
@@ -119,31 +227,48 @@ func (s *Stream) Register() error {
 
 // Post a message to the server.
 func (s *Stream) PostMessage(message string) error {
-	resp, err := postString(message, s.BaseURI+"/"+s.Address+"/message")
+	_, err := s.Post([]byte(message))
+	return err
+}
+
+// Post a message to the server, returning its 'id'.
+// message may be any bytes.
+func (s *Stream) Post(message []byte) (string, error) {
+	resp, err := s.postBytes(message, s.BaseURI+"/"+s.Address+"/message")
 	if err != nil {
-		return err
+		return "", err
+	}
+	
+	if resp.StatusCode != 201 {
+		defer resp.Body.Close()
+		return "", responseError(resp)
 	}
 	
 	m, err := decodeResponse(resp)
 	if err != nil {
-		return err
+		return "", err
 	}
 	
-	if m["ok"] == "" {
-		return errors.New("server did not return ok")
+	id, ok := m["ok"].(string)
+	if !ok || id == "" {
+		return "", errors.New("server did not return ok")
 	}
 	
-	return nil
+	return id, nil
 }
 
 // Get a message 'id' from server.
 func (s *Stream) GetMessage(id string) ([]byte, error) {
-	resp, err := get(s.BaseURI+"/"+s.Address+"/message/"+id)
+	resp, err := s.get(s.BaseURI+"/"+s.Address+"/message/"+id)
 	if err != nil {
 		return nil, err
 	}
 	
 	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, responseError(resp)
+	}
+	
 	message, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -160,11 +285,16 @@ func (s *Stream) GetIndexFrom(from string, count int) ([]string, error) {
 		uri = uri + "&count=" + strconv.Itoa(count)
 	}
 	
-	resp, err := get(uri)
+	resp, err := s.get(uri)
 	if err != nil {
 		return nil, err
 	}
 	
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	
 	a, err := decodeResponseArray(resp)
 	if err != nil {
 		return nil, err
@@ -183,13 +313,14 @@ func (s *Stream) GetIndexFrom(from string, count int) ([]string, error) {
 // above 100.
 func (s *Stream) GetIndex() ([]string, error) {
 	uri := s.BaseURI + "/" + s.Address
-	resp, err := get(uri)
+	resp, err := s.get(uri)
 	if err != nil {
 		return nil, err
 	}
 	
-	if resp.StatusCode == 404 {
-		return nil, errors.New("not found")
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
 	}
 	
 	a, err := decodeResponseArray(resp)
@@ -204,3 +335,35 @@ func (s *Stream) GetIndex() ([]string, error) {
 	
 	return list, nil
 }
+
+// Delete message 'id' from the server. The server must allow
+// deleting, and the Stream must have been registered with a Signer.
+func (s *Stream) DeleteMessage(id string) error {
+	resp, err := s.delete(s.BaseURI + "/" + s.Address + "/message/" + id)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// Delete the Stream and all of its messages from the server. As with
+// DeleteMessage, the Stream must have been registered with a Signer.
+func (s *Stream) Delete() error {
+	resp, err := s.delete(s.BaseURI + "/" + s.Address)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return responseError(resp)
+	}
+
+	return nil
+}
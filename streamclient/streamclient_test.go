@@ -1,24 +1,53 @@
 package streamclient
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/macfisherman/streammail/address"
+	"github.com/macfisherman/streammail/server"
 )
 
-const address = "SFwExaKH1iu2iK9gW3W2dnRQZewcmGkv6q"
-const baseURI = "http://localhost:8080/stream/v1"
-const baseDir = "../" + address
+const streamAddress = "SFwExaKH1iu2iK9gW3W2dnRQZewcmGkv6q"
+
+// baseURI and root are set up by TestMain
+var baseURI string
+var root string
+
+func TestMain(m *testing.M) {
+	var err error
+	root, err = ioutil.TempDir("", "streamclient")
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(server.NewServer(server.Config{Root: root, AllowDelete: true}))
+	baseURI = ts.URL + APP
+
+	code := m.Run()
+	ts.Close()
+	os.RemoveAll(root)
+	os.Exit(code)
+}
 
 func cleanup() {
-	os.RemoveAll(baseDir)
+	os.RemoveAll(filepath.Join(root, streamAddress))
 }
 
 func TestRegisterStream(t *testing.T) {
 	cleanup()
 	
-	stream := NewStream(baseURI, address)
+	stream := NewStream(baseURI, streamAddress)
 	if err := stream.Register(); err != nil {
 		t.Fatal("error registering stream", err)
 	}
@@ -27,7 +56,7 @@ func TestRegisterStream(t *testing.T) {
 func TestStreamExisting(t *testing.T) {
 	cleanup()
 	
-	stream := NewStream(baseURI, address)
+	stream := NewStream(baseURI, streamAddress)
 	if err := stream.Register(); err != nil {
 		t.Fatal("error registering stream", err)
 	}
@@ -40,7 +69,7 @@ func TestStreamExisting(t *testing.T) {
 func TestStreamMessage(t *testing.T) {
 	cleanup()
 
-	stream := NewStream(baseURI, address)
+	stream := NewStream(baseURI, streamAddress)
 	if err := stream.Register(); err != nil {
 		t.Fatal("error registering stream", err)
 	}
@@ -54,7 +83,7 @@ func TestStreamMessage(t *testing.T) {
 func TestStreamIndex(t *testing.T) {
 	cleanup()
 	
-	stream := NewStream(baseURI, address)
+	stream := NewStream(baseURI, streamAddress)
 	if err := stream.Register(); err != nil {
 		t.Fatal("error registering stream", err)
 	}
@@ -78,7 +107,7 @@ func TestStreamIndex(t *testing.T) {
 func TestStreamIndexFrom(t *testing.T) {
 	cleanup()
 
-	stream := NewStream(baseURI, address)
+	stream := NewStream(baseURI, streamAddress)
 	if err := stream.Register(); err != nil {
 		t.Fatal("error registering stream", err)
 	}
@@ -112,10 +141,47 @@ func TestStreamIndexFrom(t *testing.T) {
 	}
 }
 
+func TestStreamIterate(t *testing.T) {
+	cleanup()
+
+	stream := NewStream(baseURI, streamAddress)
+	if err := stream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+
+	for i := 0; i < 25; i++ {
+		_ = stream.PostMessage("message " + strconv.Itoa(i))
+	}
+
+	ids, next, err := stream.GetIndexPage(IndexQuery{After: "20", Count: 10})
+	if err != nil {
+		t.Fatal("error getting index", err)
+	}
+	if len(ids) != 5 || ids[0] != "21" || next != "" {
+		t.Errorf("Expected 21 to 25 and no cursor, got %v %q", ids, next)
+	}
+
+	// newest first, in pages of 7
+	it := stream.Iterate(IndexQuery{Reverse: true, Count: 7})
+	want := 25
+	for it.Next() {
+		if it.ID() != strconv.Itoa(want) {
+			t.Fatalf("Expected %d, got %s", want, it.ID())
+		}
+		want--
+	}
+	if it.Err() != nil {
+		t.Fatal("error iterating", it.Err())
+	}
+	if want != 0 {
+		t.Error("Expected to end after 1, ended after", want+1)
+	}
+}
+
 func TestStreamGetMessage(t *testing.T) {
 	cleanup()
 
-	stream := NewStream(baseURI, address)
+	stream := NewStream(baseURI, streamAddress)
 	if err := stream.Register(); err != nil {
 		t.Fatal("error registering stream", err)
 	}
@@ -143,10 +209,1038 @@ func TestStreamGetMessage(t *testing.T) {
 func TestStreamGetIndexNoAddress(t *testing.T) {
 	cleanup()
 
-	stream := NewStream(baseURI, address)
+	stream := NewStream(baseURI, streamAddress)
 	_, err := stream.GetIndex()
 	
 	if err.Error() != "not found" {
 		t.Error("got", err.Error())
 	}
-}
\ No newline at end of file
+}
+func TestSecureStream(t *testing.T) {
+	alice, err := address.NewKey()
+	if err != nil {
+		t.Fatal("error creating key", err)
+	}
+
+	bob, err := address.NewKey()
+	if err != nil {
+		t.Fatal("error creating key", err)
+	}
+
+	aliceStream, err := NewSecureStream(baseURI, alice, bob.PublicKey())
+	if err != nil {
+		t.Fatal("error creating stream", err)
+	}
+	defer os.RemoveAll(filepath.Join(root, aliceStream.Address))
+
+	bobStream, err := NewSecureStream(baseURI, bob, alice.PublicKey())
+	if err != nil {
+		t.Fatal("error creating stream", err)
+	}
+
+	if err := aliceStream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+
+	if err := aliceStream.Send([]byte("message one")); err != nil {
+		t.Fatal("error sending message", err)
+	}
+
+	list, err := bobStream.GetIndex()
+	if err != nil {
+		t.Fatal("error getting index", err)
+	}
+
+	raw, err := bobStream.GetMessage(list[0])
+	if err != nil {
+		t.Fatal("error getting body", err)
+	}
+
+	if strings.Contains(string(raw), "message one") {
+		t.Error("server stored plaintext")
+	}
+
+	msg, err := bobStream.Receive(list[0])
+	if err != nil {
+		t.Fatal("error receiving message", err)
+	}
+
+	if string(msg) != "message one" {
+		t.Error("expected [message one], got", msg)
+	}
+}
+
+func TestStreamSubscribe(t *testing.T) {
+	cleanup()
+
+	stream := NewStream(baseURI, streamAddress)
+	if err := stream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+
+	_ = stream.PostMessage("before")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// resume from the start, then see new messages as they arrive
+	events, err := stream.SubscribeMessages(ctx, "0")
+	if err != nil {
+		t.Fatal("error subscribing", err)
+	}
+
+	_ = stream.PostMessage("after")
+
+	for _, want := range []string{"before", "after"} {
+		select {
+		case e := <-events:
+			if string(e.Message) != want {
+				t.Errorf("expected [%s], got [%s]", want, e.Message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for", want)
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestStreamSubscribeReconnect(t *testing.T) {
+	cleanup()
+
+	delay := RetryDelay
+	RetryDelay = 10 * time.Millisecond
+	defer func() { RetryDelay = delay }()
+
+	// drop the first event stream before it delivers anything
+	handler := server.NewServer(server.Config{Root: root, AllowDelete: true})
+	dropped := make(chan struct{})
+	drop := make(chan struct{})
+	first := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/events") && first {
+			first = false
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(200)
+			w.(http.Flusher).Flush()
+			<-drop
+			close(dropped)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	stream := NewStream(ts.URL+APP, streamAddress)
+	if err := stream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	_ = stream.PostMessage("before")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := stream.SubscribeMessages(ctx, "")
+	if err != nil {
+		t.Fatal("error subscribing", err)
+	}
+
+	_ = stream.PostMessage("during")
+	close(drop)
+	<-dropped
+
+	select {
+	case e := <-events:
+		if string(e.Message) != "during" {
+			t.Errorf("expected [during], got [%s]", e.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message posted before the drop")
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestStreamSubscribeGone(t *testing.T) {
+	cleanup()
+
+	delay := RetryDelay
+	RetryDelay = 10 * time.Millisecond
+	defer func() { RetryDelay = delay }()
+
+	// message 1 is announced, but gone when fetched, and once gone is
+	// closed the event stream ends and is not found any more
+	handler := server.NewServer(server.Config{Root: root, AllowDelete: true})
+	gone := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/message/1") {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/events") {
+			select {
+			case <-gone:
+				http.NotFound(w, r)
+				return
+			default:
+			}
+
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			go func() {
+				select {
+				case <-gone:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			r = r.WithContext(ctx)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	stream := NewStream(ts.URL+APP, streamAddress)
+	if err := stream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	_ = stream.PostMessage("gone")
+	_ = stream.PostMessage("kept")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := stream.SubscribeMessages(ctx, "0")
+	if err != nil {
+		t.Fatal("error subscribing", err)
+	}
+
+	next := func() Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+		}
+		return Event{}
+	}
+
+	if e := next(); e.Err == nil || e.Err.Error() != "not found" {
+		t.Error("expected not found for the missing message, got", e)
+	}
+	if e := next(); e.Err != nil || string(e.Message) != "kept" {
+		t.Error("expected [kept], got", e)
+	}
+
+	// a stream no longer found ends the subscription
+	close(gone)
+	if e := next(); e.Err == nil {
+		t.Error("expected an error for the deleted stream, got", e)
+	}
+	if _, ok := <-events; ok {
+		t.Error("expected the channel to be closed")
+	}
+}
+
+func TestStreamSubscribeNoAddress(t *testing.T) {
+	cleanup()
+
+	stream := NewStream(baseURI, streamAddress)
+	_, err := stream.Subscribe(context.Background(), "")
+	if err == nil || err.Error() != "not found" {
+		t.Error("expected not found, got", err)
+	}
+}
+
+func TestSecureStreamAuthentication(t *testing.T) {
+	alice, _ := address.NewKey()
+	bob, _ := address.NewKey()
+
+	stream, err := NewSecureStream(baseURI, alice, bob.PublicKey())
+	if err != nil {
+		t.Fatal("error creating stream", err)
+	}
+	defer os.RemoveAll(filepath.Join(root, stream.Address))
+
+	if err := stream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+
+	if err := stream.Send([]byte("message one")); err != nil {
+		t.Fatal("error sending message", err)
+	}
+
+	// a third party knowing the address can neither post nor read
+	eve := NewStream(baseURI, stream.Address)
+	if err := eve.PostMessage("forged"); err == nil || err.Error() != "request must be signed" {
+		t.Error("expected request must be signed, got", err)
+	}
+
+	if _, err := eve.GetIndex(); err == nil {
+		t.Error("expected an error reading the index")
+	}
+
+	eve.Signer, _ = alice.AuthKey(alice.PublicKey())
+	if _, err := eve.GetMessage("1"); err == nil || err.Error() != "invalid signature" {
+		t.Error("expected invalid signature, got", err)
+	}
+
+	list, err := stream.GetIndex()
+	if err != nil || len(list) != 1 {
+		t.Fatal("expected one message, got", list, err)
+	}
+}
+
+func TestStreamDelete(t *testing.T) {
+	cleanup()
+
+	// streams without a Signer cannot be deleted from
+	open := NewStream(baseURI, streamAddress)
+	if err := open.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	_ = open.PostMessage("message one")
+	if err := open.DeleteMessage("1"); err == nil {
+		t.Error("expected an error deleting from a stream without a Signer")
+	}
+
+	alice, _ := address.NewKey()
+	bob, _ := address.NewKey()
+	stream, err := NewSecureStream(baseURI, alice, bob.PublicKey())
+	if err != nil {
+		t.Fatal("error creating stream", err)
+	}
+	defer os.RemoveAll(filepath.Join(root, stream.Address))
+
+	stream.Retention = Retention{MaxAge: time.Hour}
+	if err := stream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	for i := 0; i < 3; i++ {
+		_ = stream.Send([]byte("message " + strconv.Itoa(i)))
+	}
+
+	if err := stream.DeleteMessage("2"); err != nil {
+		t.Fatal("error deleting message", err)
+	}
+	if err := stream.DeleteMessage("2"); err == nil || err.Error() != "not found" {
+		t.Error("expected not found, got", err)
+	}
+
+	list, _ := stream.GetIndex()
+	if len(list) != 2 || list[0] != "1" || list[1] != "3" {
+		t.Error("expected [1 3], got", list)
+	}
+
+	if err := stream.Delete(); err != nil {
+		t.Fatal("error deleting stream", err)
+	}
+	if _, err := stream.GetIndex(); err == nil || err.Error() != "not found" {
+		t.Error("expected not found, got", err)
+	}
+}
+
+func TestSecureStreamX25519(t *testing.T) {
+	alice, _ := address.NewKeyType(address.X25519)
+	bob, _ := address.NewKeyType(address.X25519)
+
+	aliceStream, err := NewSecureStream(baseURI, alice, bob.PublicKey())
+	if err != nil {
+		t.Fatal("error creating stream", err)
+	}
+	defer os.RemoveAll(filepath.Join(root, aliceStream.Address))
+
+	if err := aliceStream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	if err := aliceStream.Send([]byte("hello bob")); err != nil {
+		t.Fatal("error sending message", err)
+	}
+
+	bobStream, _ := NewSecureStream(baseURI, bob, alice.PublicKey())
+	message, err := bobStream.Receive("1")
+	if err != nil {
+		t.Fatal("error receiving message", err)
+	}
+	if string(message) != "hello bob" {
+		t.Error("expected [hello bob], got", string(message))
+	}
+}
+
+func TestContacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	passphrase := []byte("secret")
+	aliceContacts, err := OpenContacts(filepath.Join(dir, "alice.json"), passphrase, nil)
+	if err != nil {
+		t.Fatal("error opening contacts", err)
+	}
+	bobContacts, _ := OpenContacts(filepath.Join(dir, "bob.json"), nil, nil)
+
+	bob, err := aliceContacts.Add("bob", address.P256)
+	if err != nil {
+		t.Fatal("error adding contact", err)
+	}
+	carol, _ := aliceContacts.Add("carol", address.P256)
+	alice, _ := bobContacts.Add("alice", address.P256)
+
+	if _, err := aliceContacts.Add("bob", address.P256); err != ErrContactExists {
+		t.Error("expected ErrContactExists, got", err)
+	}
+	if bob.Key.PublicKey().String() == carol.Key.PublicKey().String() {
+		t.Error("contacts share a key")
+	}
+	if _, err := bob.SecureStream(baseURI); err != ErrNoPeer {
+		t.Error("expected ErrNoPeer, got", err)
+	}
+
+	bob, err = aliceContacts.SetPeer("bob", alice.Key.PublicKey())
+	if err != nil {
+		t.Fatal("error setting peer", err)
+	}
+	alice, _ = bobContacts.SetPeer("alice", bob.Key.PublicKey())
+	if bob.Address == "" || bob.Address != alice.Address {
+		t.Errorf("addresses do not match: %s, %s", bob.Address, alice.Address)
+	}
+
+	// reopened from the file
+	reopened, err := OpenContacts(filepath.Join(dir, "alice.json"), passphrase, nil)
+	if err != nil {
+		t.Fatal("error reopening contacts", err)
+	}
+	if names := reopened.Names(); len(names) != 2 || names[0] != "bob" || names[1] != "carol" {
+		t.Error("expected [bob carol], got", names)
+	}
+
+	found, err := reopened.ByAddress(alice.Address)
+	if err != nil {
+		t.Fatal("error finding contact", err)
+	}
+	if found.Name != "bob" || found.Key.PublicKey().String() != bob.Key.PublicKey().String() {
+		t.Error("found the wrong contact", found.Name)
+	}
+
+	wrong, _ := OpenContacts(filepath.Join(dir, "alice.json"), []byte("wrong"), nil)
+	if _, err := wrong.Get("bob"); err != address.ErrPassphrase {
+		t.Error("expected ErrPassphrase, got", err)
+	}
+
+	if err := reopened.Remove("carol"); err != nil {
+		t.Fatal("error removing contact", err)
+	}
+	if _, err := reopened.Get("carol"); err != ErrNoContact {
+		t.Error("expected ErrNoContact, got", err)
+	}
+}
+
+func TestContactsKeychain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mnemonic, _ := address.NewMnemonic(128)
+	keychain, _ := address.RestoreKeychain(mnemonic, "")
+	contacts, _ := OpenContacts(filepath.Join(dir, "old.json"), nil, keychain)
+	bob, _ := contacts.Add("bob", address.X25519)
+
+	// on a new device, the same mnemonic gives the same key for bob
+	keychain, _ = address.RestoreKeychain(mnemonic, "")
+	contacts, _ = OpenContacts(filepath.Join(dir, "new.json"), nil, keychain)
+	restored, _ := contacts.Add("bob", address.X25519)
+	if bob.Key.PublicKey().String() != restored.Key.PublicKey().String() {
+		t.Error("restored key does not match")
+	}
+}
+
+func TestSecureStreamRotate(t *testing.T) {
+	alice, _ := address.NewKey()
+	bob, _ := address.NewKey()
+
+	aliceStream, _ := NewSecureStream(baseURI, alice, bob.PublicKey())
+	defer os.RemoveAll(filepath.Join(root, aliceStream.Address))
+	if err := aliceStream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+
+	bobStream, _ := NewSecureStream(baseURI, bob, alice.PublicKey())
+	aliceStream.Send([]byte("one"))
+	bobStream.Send([]byte("\x00two"))
+
+	newAlice, _ := address.NewKey()
+	next, err := aliceStream.Rotate(newAlice)
+	if err != nil {
+		t.Fatal("error rotating", err)
+	}
+	defer os.RemoveAll(filepath.Join(root, next.Address))
+	if next.Address == aliceStream.Address {
+		t.Fatal("rotated to the same address")
+	}
+	if err := next.Send([]byte("three")); err != nil {
+		t.Fatal("error sending on the new stream", err)
+	}
+
+	if _, err := bobStream.Receive("3"); err != ErrControlMessage {
+		t.Error("expected ErrControlMessage, got", err)
+	}
+
+	// bob follows alice's new key, alice follows her own
+	for _, test := range []struct {
+		stream *SecureStream
+		keys   []*address.Key
+	}{
+		{bobStream, nil},
+		{aliceStream, []*address.Key{newAlice}},
+	} {
+		messages, last, err := test.stream.History(test.keys...)
+		if err != nil {
+			t.Fatal("error reading history", err)
+		}
+		if last.Address != next.Address {
+			t.Errorf("expected to end at %s, got %s", next.Address, last.Address)
+		}
+
+		var got []string
+		for _, m := range messages {
+			got = append(got, string(m.Message))
+		}
+		if strings.Join(got, ",") != "one,\x00two,three" {
+			t.Errorf("unexpected history %q", got)
+		}
+	}
+
+	// a rotate whose address does not match its key
+	forged := &Control{Type: "rotate", Key: newAlice.PublicKey().String(), Address: aliceStream.Address}
+	if _, err := bobStream.Follow(&Received{Control: forged, Sender: SenderPeer}); err != ErrRotation {
+		t.Error("expected ErrRotation, got", err)
+	}
+}
+
+func TestSecureStreamRotateUnsigned(t *testing.T) {
+	alice, _ := address.NewKey()
+	bob, _ := address.NewKey()
+	mallory, _ := address.NewKey()
+
+	aliceStream, _ := NewSecureStream(baseURI, alice, bob.PublicKey())
+	defer os.RemoveAll(filepath.Join(root, aliceStream.Address))
+	if err := aliceStream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	bobStream, _ := NewSecureStream(baseURI, bob, alice.PublicKey())
+
+	// someone holding the stream secret, but no key, moves bob to mallory
+	malloryStream, _ := NewSecureStream(baseURI, bob, mallory.PublicKey())
+	rotate := Control{Type: "rotate", Key: mallory.PublicKey().String(), Address: malloryStream.Address}
+	aliceStream.sendControl(rotate, false)
+	aliceStream.Send([]byte("after"))
+
+	received, err := bobStream.Open("1")
+	if err != nil {
+		t.Fatal("error opening", err)
+	}
+	if _, err := bobStream.Follow(received); err != ErrRotationUnsigned {
+		t.Error("expected ErrRotationUnsigned, got", err)
+	}
+
+	messages, last, err := bobStream.History()
+	if err != nil {
+		t.Fatal("error reading history", err)
+	}
+	if last.Address != bobStream.Address || len(messages) != 1 {
+		t.Error("expected the unsigned rotate to be skipped, ended at", last.Address, len(messages))
+	}
+
+	// a rotate signed by the user needs the new key
+	if _, err := bobStream.Follow(&Received{Control: received.Control, Sender: SenderSelf}); err != ErrRotation {
+		t.Error("expected ErrRotation, got", err)
+	}
+
+	// or the user confirms the new key's fingerprint
+	if _, err := bobStream.FollowConfirmed(received.Control, "00000 00000 00000 00000 00000 00000"); err != ErrFingerprint {
+		t.Error("expected ErrFingerprint, got", err)
+	}
+	fingerprint, _ := bob.Fingerprint(mallory.PublicKey())
+	next, err := bobStream.FollowConfirmed(received.Control, fingerprint)
+	if err != nil || next.Address != malloryStream.Address {
+		t.Error("error following a confirmed rotate", err)
+	}
+}
+
+func TestSecureStreamRatchet(t *testing.T) {
+	alice, _ := address.NewKey()
+	bob, _ := address.NewKey()
+
+	aliceStream, _ := NewSecureStream(baseURI, alice, bob.PublicKey())
+	defer os.RemoveAll(filepath.Join(root, aliceStream.Address))
+	if err := aliceStream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	bobStream, _ := NewSecureStream(baseURI, bob, alice.PublicKey())
+
+	// sent before the ratchet
+	aliceStream.Send([]byte("static"))
+
+	aliceRatchet, _ := alice.Ratchet(bob.PublicKey())
+	bobRatchet, _ := bob.Ratchet(alice.PublicKey())
+	aliceStream.UseRatchet(aliceRatchet)
+	bobStream.UseRatchet(bobRatchet)
+
+	first, second := aliceStream, bobStream
+	if bobRatchet.Initiator() {
+		first, second = bobStream, aliceStream
+	}
+
+	if err := second.Send([]byte("too soon")); err != address.ErrRatchetWait {
+		t.Error("expected ErrRatchetWait, got", err)
+	}
+	if err := first.Send([]byte("hello")); err != nil {
+		t.Fatal("error sending", err)
+	}
+	if err := second.Send([]byte("")); err != address.ErrRatchetWait {
+		t.Error("expected ErrRatchetWait, got", err)
+	}
+
+	for id, want := range map[string]string{"1": "static", "2": "hello"} {
+		message, err := second.Receive(id)
+		if err != nil {
+			t.Fatal("error receiving", err)
+		}
+		if string(message) != want {
+			t.Errorf("expected %q, got %q", want, message)
+		}
+	}
+	if _, err := first.Receive("2"); err != address.ErrOwnMessage {
+		t.Error("expected ErrOwnMessage, got", err)
+	}
+
+	if err := second.Send([]byte("hi")); err != nil {
+		t.Fatal("error sending", err)
+	}
+	if message, err := first.Receive("3"); err != nil || string(message) != "hi" {
+		t.Errorf("expected hi, got %q, %v", message, err)
+	}
+}
+
+func TestSecureStreamSigned(t *testing.T) {
+	alice, _ := address.NewKey()
+	bob, _ := address.NewKey()
+	mallory, _ := address.NewKey()
+
+	aliceStream, _ := NewSecureStream(baseURI, alice, bob.PublicKey())
+	defer os.RemoveAll(filepath.Join(root, aliceStream.Address))
+	if err := aliceStream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	bobStream, _ := NewSecureStream(baseURI, bob, alice.PublicKey())
+
+	if !aliceStream.Sign {
+		t.Error("expected streams to sign by default")
+	}
+	if err := aliceStream.Send([]byte("from alice")); err != nil {
+		t.Fatal("error sending", err)
+	}
+	bobStream.Sign = false
+	bobStream.Send([]byte("unsigned"))
+
+	for _, test := range []struct {
+		stream *SecureStream
+		id     string
+		sender Sender
+	}{
+		{bobStream, "1", SenderPeer},
+		{aliceStream, "1", SenderSelf},
+		{bobStream, "2", SenderUnknown},
+	} {
+		received, err := test.stream.Open(test.id)
+		if err != nil {
+			t.Fatal("error opening", err)
+		}
+		if received.Sender != test.sender {
+			t.Errorf("message %s: expected sender %v, got %v", test.id, test.sender, received.Sender)
+		}
+	}
+
+	// bob cannot sign as alice
+	signed, _ := aliceStream.sign([]byte("from alice"))
+	forged := append([]byte{}, signed...)
+	copy(forged[len(forged)-len("from alice"):], "from bob!!")
+	envelope, _ := bobStream.sealer.Seal(forged)
+	bobStream.PostMessage(string(envelope))
+	if _, err := aliceStream.Open("3"); err != address.ErrSignature {
+		t.Error("expected ErrSignature, got", err)
+	}
+
+	// nor can anyone else
+	malloryStream, _ := NewSecureStream(baseURI, mallory, bob.PublicKey())
+	signed, _ = malloryStream.sign([]byte("from mallory"))
+	envelope, _ = bobStream.sealer.Seal(signed)
+	bobStream.PostMessage(string(envelope))
+	if _, err := aliceStream.Open("4"); err != ErrSender {
+		t.Error("expected ErrSender, got", err)
+	}
+
+	// unsigned messages are refused when signatures are required
+	aliceStream.RequireSigned = true
+	if _, err := aliceStream.Open("2"); err != ErrUnsigned {
+		t.Error("expected ErrUnsigned, got", err)
+	}
+	if _, err := aliceStream.Open("1"); err != nil {
+		t.Error("error opening signed message", err)
+	}
+
+	// X25519 keys sign too
+	x25519, _ := address.NewKeyType(address.X25519)
+	other, _ := address.NewKeyType(address.X25519)
+	x25519Stream, _ := NewSecureStream(baseURI, x25519, other.PublicKey())
+	defer os.RemoveAll(filepath.Join(root, x25519Stream.Address))
+	x25519Stream.Register()
+	if err := x25519Stream.Send([]byte("hello")); err != nil {
+		t.Fatal("error sending", err)
+	}
+	otherStream, _ := NewSecureStream(baseURI, other, x25519.PublicKey())
+	otherStream.RequireSigned = true
+	if received, err := otherStream.Open("1"); err != nil || received.Sender != SenderPeer {
+		t.Error("expected an X25519 signed message, got", received, err)
+	}
+
+	// a peer key imported without its signing key reads it as unsigned
+	bare, _ := address.UnmarshalPublic(address.X25519, x25519.PublicKey().Marshal())
+	bareStream, _ := NewSecureStream(baseURI, other, bare)
+	if received, err := bareStream.Open("1"); err != nil || string(received.Message) != "hello" || received.Sender != SenderUnknown {
+		t.Error("expected an unverified message, got", received, err)
+	}
+	bareStream.RequireSigned = true
+	if _, err := bareStream.Open("1"); err != ErrUnsigned {
+		t.Error("expected ErrUnsigned, got", err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	alice, _ := address.NewKey()
+	bob, _ := address.NewKey()
+	carol, _ := address.NewKey()
+	dave, _ := address.NewKey()
+
+	// the streams alice shares with each of them
+	for _, peer := range []*address.Key{bob, carol, dave} {
+		s, _ := NewSecureStream(baseURI, alice, peer.PublicKey())
+		defer os.RemoveAll(filepath.Join(root, s.Address))
+		if err := s.Register(); err != nil {
+			t.Fatal("error registering stream", err)
+		}
+	}
+
+	group, err := NewGroup("team", alice, bob.PublicKey(), carol.PublicKey())
+	if err != nil {
+		t.Fatal("error creating group", err)
+	}
+	aliceGroup, _ := group.Stream(baseURI, alice)
+	defer os.RemoveAll(filepath.Join(root, aliceGroup.Address))
+	if err := aliceGroup.Register(); err != nil {
+		t.Fatal("error registering group", err)
+	}
+	if err := group.Distribute(baseURI, alice); err != nil {
+		t.Fatal("error distributing group", err)
+	}
+
+	// bob and carol join from the streams they share with alice
+	join := func(member *address.Key, id string) *Group {
+		s, _ := NewSecureStream(baseURI, member, alice.PublicKey())
+		g, err := s.ReceiveGroup(id)
+		if err != nil {
+			t.Fatal("error receiving group", err)
+		}
+		return g
+	}
+
+	bobGroup, _ := join(bob, "1").Stream(baseURI, bob)
+	carolGroup, _ := join(carol, "1").Stream(baseURI, carol)
+	if bobGroup.Address != aliceGroup.Address || carolGroup.Address != aliceGroup.Address {
+		t.Fatal("group addresses do not match")
+	}
+
+	bobGroup.Sign = true
+	if err := bobGroup.Send([]byte("hello team")); err != nil {
+		t.Fatal("error sending to group", err)
+	}
+	received, err := carolGroup.Open("1")
+	if err != nil {
+		t.Fatal("error opening group message", err)
+	}
+	if string(received.Message) != "hello team" || received.Sender != SenderPeer ||
+		received.From.String() != bob.PublicKey().String() {
+		t.Errorf("unexpected message %q from %v", received.Message, received.From)
+	}
+
+	// removing carol rekeys the group without her
+	next, err := group.Remove(carol.PublicKey())
+	if err != nil {
+		t.Fatal("error removing member", err)
+	}
+	if next.Epoch != 1 || next.Previous != group.Address() || next.Member(carol.PublicKey()) {
+		t.Error("unexpected next epoch", next.Epoch, next.Previous)
+	}
+	nextStream, _ := next.Stream(baseURI, alice)
+	defer os.RemoveAll(filepath.Join(root, nextStream.Address))
+	nextStream.Register()
+	next.Distribute(baseURI, alice)
+
+	if g := join(bob, "2"); g.Address() != next.Address() {
+		t.Error("bob did not get the new epoch")
+	}
+	nextStream.Send([]byte("without carol"))
+	// the server refuses carol's requests, signed with the old auth key
+	carolGroup.Stream.Address = next.Address()
+	if _, err := carolGroup.Receive("1"); err == nil {
+		t.Error("expected carol not to read the new epoch")
+	}
+
+	if _, err := next.Add(bob.PublicKey()); err != ErrMember {
+		t.Error("expected ErrMember, got", err)
+	}
+	if _, err := next.Remove(dave.PublicKey()); err != ErrNotMember {
+		t.Error("expected ErrNotMember, got", err)
+	}
+	daveStream, _ := NewSecureStream(baseURI, alice, dave.PublicKey())
+	if err := next.Invite(daveStream); err != ErrNotMember {
+		t.Error("expected ErrNotMember, got", err)
+	}
+
+	added, _ := next.Add(dave.PublicKey())
+	if !added.Member(dave.PublicKey()) || added.Address() == next.Address() {
+		t.Error("adding a member did not rekey the group")
+	}
+}
+
+func TestSecureStreamAttachment(t *testing.T) {
+	alice, _ := address.NewKey()
+	bob, _ := address.NewKey()
+
+	aliceStream, _ := NewSecureStream(baseURI, alice, bob.PublicKey())
+	defer os.RemoveAll(filepath.Join(root, aliceStream.Address))
+	if err := aliceStream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	bobStream, _ := NewSecureStream(baseURI, bob, alice.PublicKey())
+
+	content := make([]byte, 2*ChunkSize+100)
+	rand.Read(content)
+	aliceStream.Sign = true
+	sent, err := aliceStream.SendAttachment("file.bin", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal("error sending attachment", err)
+	}
+	if len(sent.Chunks) != 3 || sent.Size != int64(len(content)) {
+		t.Errorf("expected 3 chunks of %d bytes, got %d of %d", len(content), len(sent.Chunks), sent.Size)
+	}
+
+	if _, err := bobStream.Open("1"); err != ErrAttachmentChunk {
+		t.Error("expected ErrAttachmentChunk, got", err)
+	}
+	received, err := bobStream.Open("4")
+	if err != nil {
+		t.Fatal("error opening manifest", err)
+	}
+	if received.Control == nil || received.Control.Attachment == nil || received.Sender != SenderPeer {
+		t.Fatal("expected a signed attachment manifest, got", received)
+	}
+	a := received.Control.Attachment
+	if a.Name != "file.bin" {
+		t.Error("expected file.bin, got", a.Name)
+	}
+
+	var buf bytes.Buffer
+	if err := bobStream.ReadAttachment(a, &buf); err != nil {
+		t.Fatal("error reading attachment", err)
+	}
+	if !bytes.Equal(buf.Bytes(), content) {
+		t.Error("attachment content differs")
+	}
+
+	// with a Padding, the server cannot tell the size from the final chunk
+	aliceStream.Padding = address.BlockPadding(4096)
+	padded, err := aliceStream.SendAttachment("small", strings.NewReader("small"))
+	if err != nil {
+		t.Fatal("error sending padded attachment", err)
+	}
+	aliceStream.Padding = nil
+	if envelope, _ := bobStream.GetMessage(padded.Chunks[0]); !padded.Padded || len(envelope) < 4096 {
+		t.Errorf("expected a padded chunk, got %d bytes", len(envelope))
+	}
+	buf.Reset()
+	if err := bobStream.ReadAttachment(padded, &buf); err != nil || buf.String() != "small" {
+		t.Errorf("expected [small], got [%s] %v", buf.String(), err)
+	}
+
+	// an empty attachment is one empty chunk
+	empty, err := bobStream.SendAttachment("empty", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal("error sending empty attachment", err)
+	}
+	buf.Reset()
+	if err := aliceStream.ReadAttachment(empty, &buf); err != nil || len(empty.Chunks) != 1 || buf.Len() != 0 {
+		t.Error("error reading empty attachment", len(empty.Chunks), buf.Len(), err)
+	}
+
+	messages, _, err := bobStream.History()
+	if err != nil {
+		t.Fatal("error reading history", err)
+	}
+	if len(messages) != 3 || messages[0].Attachment == nil || messages[2].Attachment == nil {
+		t.Error("expected 3 attachments in history, got", messages)
+	}
+
+	// chunks cut short, reordered or from another attachment are refused
+	for _, chunks := range [][]string{
+		a.Chunks[:2],
+		{a.Chunks[1], a.Chunks[0], a.Chunks[2]},
+		{a.Chunks[0], a.Chunks[1], empty.Chunks[0]},
+	} {
+		changed := *a
+		changed.Chunks = chunks
+		if err := bobStream.ReadAttachment(&changed, ioutil.Discard); err != address.ErrEnvelopeOpen {
+			t.Error("expected ErrEnvelopeOpen, got", err)
+		}
+	}
+
+	changed := *a
+	changed.SHA256 = empty.SHA256
+	if err := bobStream.ReadAttachment(&changed, ioutil.Discard); err != ErrAttachment {
+		t.Error("expected ErrAttachment, got", err)
+	}
+}
+
+func TestSecureStreamPadding(t *testing.T) {
+	alice, _ := address.NewKey()
+	bob, _ := address.NewKey()
+
+	aliceStream, _ := NewSecureStream(baseURI, alice, bob.PublicKey())
+	defer os.RemoveAll(filepath.Join(root, aliceStream.Address))
+	if err := aliceStream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	bobStream, _ := NewSecureStream(baseURI, bob, alice.PublicKey())
+
+	aliceStream.Padding = address.BlockPadding(256)
+	aliceStream.Sign = true
+	messages := []string{"hi", strings.Repeat("a longer message ", 5), "\x00starts with zero"}
+	for _, message := range messages {
+		if err := aliceStream.Send([]byte(message)); err != nil {
+			t.Fatal("error sending", err)
+		}
+	}
+	aliceStream.Padding = address.PowerOfTwoPadding(0)
+	aliceStream.sendControl(Control{Type: "test"}, true)
+
+	first, _ := bobStream.GetMessage("1")
+	for i, message := range messages {
+		id := strconv.Itoa(i + 1)
+		if envelope, _ := bobStream.GetMessage(id); len(envelope) != len(first) {
+			t.Errorf("message %s: expected %d bytes, got %d", id, len(first), len(envelope))
+		}
+
+		received, err := bobStream.Open(id)
+		if err != nil {
+			t.Fatal("error opening", err)
+		}
+		if string(received.Message) != message || received.Sender != SenderPeer {
+			t.Errorf("expected %q from peer, got %q from %v", message, received.Message, received.Sender)
+		}
+	}
+
+	if received, err := bobStream.Open("4"); err != nil || received.Control == nil || received.Control.Type != "test" {
+		t.Error("expected a padded control message, got", received, err)
+	}
+
+	// a plaintext that looks padded, sent without Padding, is not unpadded
+	looksPadded := paddedPrefix + "not padded"
+	if err := bobStream.send([]byte(looksPadded), false); err != nil {
+		t.Fatal("error sending", err)
+	}
+	if received, err := aliceStream.Open("5"); err != nil || string(received.Message) != looksPadded {
+		t.Errorf("expected %q, got %v %v", looksPadded, received, err)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	m := NewMessage("", []byte("line one\nline two\n"))
+	m.Subject = "hello"
+	m.ReplyTo = "3"
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal("error marshaling", err)
+	}
+
+	var got Message
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal("error unmarshaling", err)
+	}
+	if !got.Time.Equal(m.Time) || got.Subject != "hello" || got.ReplyTo != "3" || string(got.Body) != string(m.Body) {
+		t.Error("expected", m, "got", got)
+	}
+	if got.Type() != DefaultContentType {
+		t.Error("expected default content type, got", got.Type())
+	}
+
+	for _, test := range []struct {
+		data string
+		err  error
+	}{
+		{"hello", ErrMessageFormat},
+		{messagePrefix + `{"version":1}`, ErrMessageFormat},
+		{messagePrefix + "not json\nbody", ErrMessageFormat},
+		{messagePrefix + `{"version":2}` + "\nbody", ErrMessageVersion},
+	} {
+		if err := got.UnmarshalBinary([]byte(test.data)); err != test.err {
+			t.Errorf("%q: expected %v, got %v", test.data, test.err, err)
+		}
+	}
+}
+
+func TestSecureStreamMessage(t *testing.T) {
+	alice, _ := address.NewKey()
+	bob, _ := address.NewKey()
+
+	aliceStream, _ := NewSecureStream(baseURI, alice, bob.PublicKey())
+	defer os.RemoveAll(filepath.Join(root, aliceStream.Address))
+	if err := aliceStream.Register(); err != nil {
+		t.Fatal("error registering stream", err)
+	}
+	bobStream, _ := NewSecureStream(baseURI, bob, alice.PublicKey())
+
+	aliceStream.Send([]byte("plain"))
+	reply := NewMessage("text/markdown", []byte("*reply*"))
+	reply.ReplyTo = "1"
+	bobStream.Sign = true
+	if err := bobStream.SendMessage(reply); err != nil {
+		t.Fatal("error sending message", err)
+	}
+
+	received, err := aliceStream.Open("2")
+	if err != nil {
+		t.Fatal("error opening", err)
+	}
+	m := received.Structured
+	if m == nil || m.ReplyTo != "1" || m.Type() != "text/markdown" || received.Sender != SenderPeer {
+		t.Fatal("expected a signed reply, got", received)
+	}
+
+	// clients reading plain messages see the body
+	if message, err := aliceStream.Receive("2"); err != nil || string(message) != "*reply*" {
+		t.Errorf("expected *reply*, got %q, %v", message, err)
+	}
+
+	messages, _, err := aliceStream.History()
+	if err != nil || len(messages) != 2 || messages[0].Structured != nil || messages[1].Structured == nil {
+		t.Error("unexpected history", messages, err)
+	}
+}
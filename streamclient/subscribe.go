@@ -0,0 +1,197 @@
+// Copyright 2016 Jeff Macdonald <macfisherman@gmail.com>
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package streamclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How long Subscribe waits before reconnecting a dropped event stream.
+// The wait doubles, up to MaxRetryDelay, while reconnecting fails.
+var (
+	RetryDelay    = time.Second
+	MaxRetryDelay = time.Minute
+)
+
+// An Event announces a message added to a Stream.
+type Event struct {
+	ID   string
+	Time time.Time
+
+	// Message holds the message itself when the Event was
+	// delivered by SubscribeMessages.
+	Message []byte
+
+	// Err is set when the server refused to give the message, as when
+	// it was deleted since, or refuses the event stream itself, as when
+	// the Stream was deleted; the channel is then closed.
+	Err error
+}
+
+// Subscribe delivers the id of every message added to the Stream after
+// message 'lastID'. If lastID is empty, only messages added from now on
+// are delivered. Dropped connections are re-established, resuming after
+// the last delivered id. The channel is closed once ctx is done, or
+// after an Event with an Err for the event stream.
+func (s *Stream) Subscribe(ctx context.Context, lastID string) (<-chan Event, error) {
+	return s.subscribe(ctx, lastID, false)
+}
+
+// SubscribeMessages is like Subscribe, but also fetches each message.
+func (s *Stream) SubscribeMessages(ctx context.Context, lastID string) (<-chan Event, error) {
+	return s.subscribe(ctx, lastID, true)
+}
+
+func (s *Stream) subscribe(ctx context.Context, lastID string, withMessages bool) (<-chan Event, error) {
+	// start after the newest message rather than at whatever the server
+	// holds when connected, so messages posted before a connection that
+	// drops before its first event are still delivered on reconnect
+	if lastID == "" {
+		ids, _, err := s.GetIndexPage(IndexQuery{Reverse: true, Count: 1})
+		if err != nil {
+			return nil, err
+		}
+
+		lastID = "0"
+		if len(ids) > 0 {
+			lastID = ids[0]
+		}
+	}
+
+	// connect once up front, so a bad address is reported to the caller
+	resp, err := s.connectEvents(ctx, lastID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		delay := RetryDelay
+		for {
+			id := s.readEvents(ctx, resp, lastID, withMessages, events)
+			if id != lastID {
+				delay = RetryDelay
+			}
+			lastID = id
+
+			// reconnect until it works, the server refuses or the
+			// caller gives up
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+				if delay *= 2; delay > MaxRetryDelay {
+					delay = MaxRetryDelay
+				}
+
+				if resp, err = s.connectEvents(ctx, lastID); err == nil {
+					break
+				}
+				if refused(err) {
+					select {
+					case events <- Event{Err: err}:
+					case <-ctx.Done():
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// refused tells whether err is the server's answer, which trying again
+// will not change, rather than a failure to reach it.
+func refused(err error) bool {
+	var status *statusError
+	return errors.As(err, &status)
+}
+
+// connectEvents opens the event stream, resuming after lastID.
+func (s *Stream) connectEvents(ctx context.Context, lastID string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", s.BaseURI+"/"+s.Address+"/events", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+
+	return resp, nil
+}
+
+// readEvents passes events from resp to events until the connection ends,
+// and returns the id of the last event passed on. Messages the server
+// refuses to give are passed on with an Err, others end the connection.
+func (s *Stream) readEvents(ctx context.Context, resp *http.Response, lastID string, withMessages bool, events chan<- Event) string {
+	defer resp.Body.Close()
+
+	var id, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(line[3:])
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(line[5:])
+		case line == "" && data != "":
+			var v struct {
+				ID   string `json:"id"`
+				Time string `json:"time"`
+			}
+			if err := json.Unmarshal([]byte(data), &v); err != nil {
+				return lastID
+			}
+			if v.ID == "" {
+				v.ID = id
+			}
+
+			e := Event{ID: v.ID}
+			e.Time, _ = time.Parse(time.RFC3339Nano, v.Time)
+			if withMessages {
+				msg, err := s.GetMessage(e.ID)
+				if err != nil && !refused(err) {
+					return lastID
+				}
+				e.Message, e.Err = msg, err
+			}
+
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return lastID
+			}
+
+			lastID = e.ID
+			id, data = "", ""
+		}
+	}
+
+	return lastID
+}